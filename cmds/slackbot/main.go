@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/insomniacslk/slackbot/pkg/bot"
 	_ "github.com/insomniacslk/slackbot/plugins/oncall"
 	_ "github.com/insomniacslk/slackbot/plugins/pinger"
@@ -16,28 +22,143 @@ var (
 )
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-c config] [check]\n\nRun the bot, or check its credentials and Slack scopes with `check`.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	viper.SetConfigFile(*flagConfig)
-	viper.SetConfigType("yaml")
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// TODO create new config file
-			logrus.Fatalf("Config file not found")
-		} else {
-			logrus.Fatalf("Failed to read config file: %v", err)
-		}
-	}
-	var config bot.Config
-	if err := viper.Unmarshal(&config); err != nil {
-		logrus.Fatalf("Failed to unmarshal config: %v", err)
+	config, err := loadConfig(*flagConfig)
+	if err != nil {
+		logrus.Fatal(err)
 	}
 	if err := config.Validate(); err != nil {
 		logrus.Fatalf("Invalid config: %v", err)
 	}
 
-	b := bot.New(&config)
-	if err := b.Start(); err != nil {
-		log.Fatal(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// SIGHUP is handled before the bot runs, since by default it terminates
+	// the process.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	b := bot.New(config)
+	switch flag.Arg(0) {
+	case "":
+	case "check":
+		os.Exit(check(ctx, b))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	go reloadOnChange(ctx, b, *flagConfig, hup)
+	if err := b.Run(ctx); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// check runs the bot's self-check, prints the report and returns the exit
+// status.
+func check(ctx context.Context, b *bot.Bot) int {
+	report := b.Check(ctx)
+	fmt.Println(report)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// loadConfig reads the configuration file at path. It uses its own viper
+// instance, since viper is not safe for concurrent use.
+func loadConfig(path string) (*bot.Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+	var config bot.Config
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	return &config, nil
+}
+
+// reloadOnChange reloads the bot configuration from path when the file
+// changes or when a signal is received on hup, until ctx is done.
+func reloadOnChange(ctx context.Context, b *bot.Bot, path string, hup <-chan os.Signal) {
+	reload := make(chan string, 1)
+	trigger := func(reason string) {
+		select {
+		case reload <- reason:
+		default:
+			// a reload is already pending
+		}
+	}
+	if err := watchConfig(ctx, path, func() { trigger("config file changed") }); err != nil {
+		logrus.Errorf("Failed to watch the config file, send SIGHUP to reload it: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			trigger("SIGHUP received")
+		case reason := <-reload:
+			logrus.Infof("Reloading configuration: %s", reason)
+			config, err := loadConfig(path)
+			if err != nil {
+				logrus.Errorf("Keeping the previous configuration: %v", err)
+				continue
+			}
+			// Reload logs and reports validation errors
+			_ = b.Reload(config)
+		}
+	}
+}
+
+// watchConfig calls changed when the file at path changes, until ctx is done.
+// The parent directory is watched, since editors and deployment tools often
+// replace the file, or the symlink pointing to it, instead of writing it.
+func watchConfig(ctx context.Context, path string, changed func()) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		_ = w.Close()
+		return err
+	}
+	realPath, _ := filepath.EvalSymlinks(path)
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// the symlink may now point to another file.
+				target, _ := filepath.EvalSymlinks(path)
+				if (filepath.Clean(ev.Name) == path && ev.Op&(fsnotify.Write|fsnotify.Create) != 0) || (target != "" && target != realPath) {
+					realPath = target
+					changed()
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logrus.Warnf("Config file watcher error: %v", err)
+			}
+		}
+	}()
+	return nil
 }
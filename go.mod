@@ -4,6 +4,8 @@ go 1.22.1
 
 require (
 	github.com/PagerDuty/go-pagerduty v1.8.0
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/insomniacslk/hours v0.0.0-20240606223201-9dd8c17f7af8
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
 	github.com/mitchellh/go-homedir v1.1.0
@@ -14,9 +16,7 @@ require (
 )
 
 require (
-	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
-	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
@@ -0,0 +1,251 @@
+// Package acl implements the access control rules that decide who can run
+// which commands, and which users hold named permissions.
+package acl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policies and rule actions.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Subjects selects users and channels. A user matches if they are listed in
+// Users or are a member of one of the UserGroups, or if both are empty. A
+// channel matches if it is listed in Channels, or if Channels is empty.
+type Subjects struct {
+	// Users are Slack user IDs.
+	Users []string `mapstructure:"users,omitempty"`
+	// UserGroups are Slack user group handles, without the leading `@`.
+	UserGroups []string `mapstructure:"usergroups,omitempty"`
+	// Channels are Slack channel IDs.
+	Channels []string `mapstructure:"channels,omitempty"`
+}
+
+// Rule allows or denies commands to a set of subjects.
+type Rule struct {
+	// Action is either "allow" or "deny".
+	Action string `mapstructure:"action"`
+	// Commands are the command names the rule applies to, without the
+	// command prefix. If both Commands and Plugins are empty, the rule
+	// applies to all the commands.
+	Commands []string `mapstructure:"commands,omitempty"`
+	// Plugins are the plugin types, e.g. "pinger", or instance names, e.g.
+	// "pinger/sre", whose commands the rule applies to.
+	Plugins  []string `mapstructure:"plugins,omitempty"`
+	Subjects `mapstructure:",squash"`
+}
+
+// Config is the access control configuration.
+type Config struct {
+	// Default is the policy applied when no rule matches, either "allow" or
+	// "deny". Defaults to "allow".
+	Default string `mapstructure:"default,omitempty"`
+	// Rules are evaluated in order, and the first matching rule decides.
+	Rules []Rule `mapstructure:"rules,omitempty"`
+	// Permissions maps permission names to the subjects holding them.
+	// Plugins can check them, e.g. before running write operations.
+	Permissions map[string]Subjects `mapstructure:"permissions,omitempty"`
+}
+
+// Validate checks the configuration and sets the defaults.
+func (c *Config) Validate() error {
+	switch c.Default {
+	case "":
+		c.Default = Allow
+	case Allow, Deny:
+	default:
+		return fmt.Errorf("invalid default policy %q, must be %q or %q", c.Default, Allow, Deny)
+	}
+	for i, r := range c.Rules {
+		if r.Action != Allow && r.Action != Deny {
+			return fmt.Errorf("rule %d: invalid action %q, must be %q or %q", i+1, r.Action, Allow, Deny)
+		}
+		c.Rules[i].Subjects.normalize()
+	}
+	for name, s := range c.Permissions {
+		s.normalize()
+		c.Permissions[name] = s
+	}
+	return nil
+}
+
+// UsesUserGroups returns true if any rule or permission refers to a user
+// group, in which case the bot needs the `usergroups:read` scope.
+func (c *Config) UsesUserGroups() bool {
+	for _, r := range c.Rules {
+		if len(r.UserGroups) > 0 {
+			return true
+		}
+	}
+	for _, s := range c.Permissions {
+		if len(s.UserGroups) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize removes the leading `@` from the user group handles.
+func (s *Subjects) normalize() {
+	for i, handle := range s.UserGroups {
+		s.UserGroups[i] = strings.TrimPrefix(handle, "@")
+	}
+}
+
+// Request is a command invocation to authorize.
+type Request struct {
+	User    string
+	Channel string
+	// Command is the name of the invoked command, without the prefix.
+	Command string
+	// Plugin and PluginType are the name and the type of the plugin
+	// instance handling the command.
+	Plugin     string
+	PluginType string
+}
+
+// Decision is the result of an authorization.
+type Decision struct {
+	Allowed bool
+	// Rule is the 1-based index of the rule that decided, or 0 if the
+	// default policy was applied.
+	Rule int
+}
+
+func (d Decision) String() string {
+	verb := "denied"
+	if d.Allowed {
+		verb = "allowed"
+	}
+	if d.Rule == 0 {
+		return verb + " by the default policy"
+	}
+	return fmt.Sprintf("%s by rule %d", verb, d.Rule)
+}
+
+// GroupResolver returns the members of a user group.
+type GroupResolver interface {
+	GetUserGroupMembers(ctx context.Context, handle string) ([]string, error)
+}
+
+// Authorize evaluates the rules for req. It returns an error if a user group
+// could not be resolved, in which case the request should be denied.
+func (c *Config) Authorize(ctx context.Context, groups GroupResolver, req Request) (Decision, error) {
+	for i, r := range c.Rules {
+		if !r.appliesTo(req) {
+			continue
+		}
+		ok, err := r.Subjects.match(ctx, groups, req.User, req.Channel)
+		if err != nil {
+			return Decision{Rule: i + 1}, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if ok {
+			return Decision{Allowed: r.Action == Allow, Rule: i + 1}, nil
+		}
+	}
+	return Decision{Allowed: c.Default != Deny}, nil
+}
+
+// HasPermission returns true if the user, in the given channel, holds the
+// named permission. Unknown permissions are not held by anyone.
+func (c *Config) HasPermission(ctx context.Context, groups GroupResolver, user, channel, permission string) (bool, error) {
+	s, ok := c.Permissions[permission]
+	if !ok {
+		return false, nil
+	}
+	return s.match(ctx, groups, user, channel)
+}
+
+func (r *Rule) appliesTo(req Request) bool {
+	if len(r.Commands) == 0 && len(r.Plugins) == 0 {
+		return true
+	}
+	return contains(r.Commands, req.Command) || contains(r.Plugins, req.Plugin) || contains(r.Plugins, req.PluginType)
+}
+
+func (s *Subjects) match(ctx context.Context, groups GroupResolver, user, channel string) (bool, error) {
+	if len(s.Channels) > 0 && !contains(s.Channels, channel) {
+		return false, nil
+	}
+	if len(s.Users) == 0 && len(s.UserGroups) == 0 {
+		return true, nil
+	}
+	if contains(s.Users, user) {
+		return true, nil
+	}
+	for _, handle := range s.UserGroups {
+		members, err := groups.GetUserGroupMembers(ctx, handle)
+		if err != nil {
+			return false, fmt.Errorf("failed to get members of user group %q: %w", handle, err)
+		}
+		if contains(members, user) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultGroupCacheTTL is how long user group members are cached.
+var DefaultGroupCacheTTL = 5 * time.Minute
+
+// GroupCache is a GroupResolver that caches the members of the user groups,
+// to avoid calling the Slack API on every command.
+type GroupCache struct {
+	resolver GroupResolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]groupEntry
+}
+
+type groupEntry struct {
+	members []string
+	expires time.Time
+}
+
+// NewGroupCache returns a GroupCache backed by resolver. If ttl is zero,
+// DefaultGroupCacheTTL is used.
+func NewGroupCache(resolver GroupResolver, ttl time.Duration) *GroupCache {
+	if ttl == 0 {
+		ttl = DefaultGroupCacheTTL
+	}
+	return &GroupCache{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]groupEntry),
+	}
+}
+
+// GetUserGroupMembers implements GroupResolver.
+func (g *GroupCache) GetUserGroupMembers(ctx context.Context, handle string) ([]string, error) {
+	g.mu.Lock()
+	e, ok := g.entries[handle]
+	g.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.members, nil
+	}
+	members, err := g.resolver.GetUserGroupMembers(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	g.entries[handle] = groupEntry{members: members, expires: time.Now().Add(g.ttl)}
+	g.mu.Unlock()
+	return members, nil
+}
@@ -0,0 +1,146 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// groups is a GroupResolver counting its calls.
+type groups struct {
+	members map[string][]string
+	calls   int
+}
+
+func (g *groups) GetUserGroupMembers(ctx context.Context, handle string) ([]string, error) {
+	g.calls++
+	m, ok := g.members[handle]
+	if !ok {
+		return nil, errors.New("no such group")
+	}
+	return m, nil
+}
+
+func TestAuthorize(t *testing.T) {
+	cfg := Config{
+		Default: Deny,
+		Rules: []Rule{
+			{Action: Deny, Commands: []string{"deploy"}, Subjects: Subjects{Channels: []string{"CRANDOM"}}},
+			{Action: Allow, Commands: []string{"deploy"}, Subjects: Subjects{UserGroups: []string{"@sre"}}},
+			{Action: Allow, Plugins: []string{"pinger"}},
+			{Action: Allow, Plugins: []string{"oncall/sre"}, Subjects: Subjects{Users: []string{"U1"}}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	g := &groups{members: map[string][]string{"sre": {"U1", "U2"}}}
+	for _, tc := range []struct {
+		name string
+		req  Request
+		want Decision
+	}{
+		{"denied channel", Request{User: "U1", Channel: "CRANDOM", Command: "deploy"}, Decision{Rule: 1}},
+		{"group member", Request{User: "U2", Channel: "C1", Command: "deploy"}, Decision{Allowed: true, Rule: 2}},
+		{"not a group member", Request{User: "U3", Channel: "C1", Command: "deploy"}, Decision{}},
+		{"plugin type", Request{User: "U3", Command: "ping", Plugin: "pinger/sre", PluginType: "pinger"}, Decision{Allowed: true, Rule: 3}},
+		{"plugin instance", Request{User: "U1", Command: "oncall", Plugin: "oncall/sre", PluginType: "oncall"}, Decision{Allowed: true, Rule: 4}},
+		{"other instance", Request{User: "U1", Command: "oncall", Plugin: "oncall/web", PluginType: "oncall"}, Decision{}},
+	} {
+		got, err := cfg.Authorize(context.Background(), g, tc.req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAuthorizeDefault(t *testing.T) {
+	var cfg Config
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := cfg.Authorize(context.Background(), nil, Request{User: "U1", Command: "any"})
+	if err != nil || !d.Allowed || d.Rule != 0 {
+		t.Errorf("got %v, %v, want allowed by the default policy", d, err)
+	}
+}
+
+func TestAuthorizeGroupError(t *testing.T) {
+	cfg := Config{Rules: []Rule{{Action: Allow, Subjects: Subjects{UserGroups: []string{"missing"}}}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := cfg.Authorize(context.Background(), &groups{}, Request{User: "U1", Command: "any"})
+	if err == nil || d.Allowed {
+		t.Errorf("got %v, %v, want an error", d, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, cfg := range []Config{
+		{Default: "maybe"},
+		{Rules: []Rule{{Action: "permit"}}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	cfg := Config{Permissions: map[string]Subjects{
+		"write": {UserGroups: []string{"@sre"}, Channels: []string{"COPS"}},
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	g := &groups{members: map[string][]string{"sre": {"U1"}}}
+	for _, tc := range []struct {
+		user, channel, permission string
+		want                      bool
+	}{
+		{"U1", "COPS", "write", true},
+		{"U1", "C1", "write", false},
+		{"U2", "COPS", "write", false},
+		{"U1", "COPS", "unknown", false},
+	} {
+		got, err := cfg.HasPermission(context.Background(), g, tc.user, tc.channel, tc.permission)
+		if err != nil || got != tc.want {
+			t.Errorf("HasPermission(%s, %s, %s) = %v, %v, want %v", tc.user, tc.channel, tc.permission, got, err, tc.want)
+		}
+	}
+}
+
+func TestGroupCache(t *testing.T) {
+	g := &groups{members: map[string][]string{"sre": {"U1"}}}
+	c := NewGroupCache(g, 20*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetUserGroupMembers(context.Background(), "sre"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g.calls != 1 {
+		t.Errorf("got %d calls, want 1", g.calls)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.GetUserGroupMembers(context.Background(), "sre"); err != nil {
+		t.Fatal(err)
+	}
+	if g.calls != 2 {
+		t.Errorf("got %d calls after the expiration, want 2", g.calls)
+	}
+	// errors are not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetUserGroupMembers(context.Background(), "missing"); err == nil {
+			t.Errorf("expected an error")
+		}
+	}
+	if g.calls != 4 {
+		t.Errorf("got %d calls, want 4", g.calls)
+	}
+}
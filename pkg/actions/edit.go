@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"context"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+)
+
+// SayEphemeral posts a plain text message that is only visible to user.
+// Errors are logged and returned.
+func SayEphemeral(ctx context.Context, client chat.Client, dest, threadTS, user, fmts string, args ...interface{}) error {
+	return NewMessage(fmts, args...).PostEphemeral(ctx, client, dest, threadTS, user)
+}
+
+// Edit replaces the message identified by ref with plain text, removing its
+// blocks. Errors are logged and returned.
+func Edit(ctx context.Context, client chat.Client, ref chat.MessageRef, fmts string, args ...interface{}) error {
+	return NewMessage(fmts, args...).Update(ctx, client, ref)
+}
+
+// Delete deletes the message identified by ref. Errors are logged and
+// returned.
+func Delete(ctx context.Context, client chat.Client, ref chat.MessageRef) error {
+	if err := client.DeleteMessage(ctx, ref); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to delete message: %v", err)
+		return err
+	}
+	return nil
+}
+
+// React adds an emoji reaction, e.g. "white_check_mark", to the message
+// identified by ref. Errors are logged and returned.
+func React(ctx context.Context, client chat.Client, ref chat.MessageRef, name string) error {
+	if err := client.AddReaction(ctx, ref.Channel, ref.Timestamp, name); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to add reaction %q: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+// Unreact removes an emoji reaction from the message identified by ref.
+// Errors are logged and returned.
+func Unreact(ctx context.Context, client chat.Client, ref chat.MessageRef, name string) error {
+	if err := client.RemoveReaction(ctx, ref.Channel, ref.Timestamp, name); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to remove reaction %q: %v", name, err)
+		return err
+	}
+	return nil
+}
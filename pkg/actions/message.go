@@ -0,0 +1,176 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+)
+
+// maxSectionFields is the maximum number of fields of a Slack section block.
+const maxSectionFields = 10
+
+// MessageBuilder builds a message made of Block Kit layout blocks, e.g.
+//
+//	ref, err := actions.NewMessage("Oncall for %s", name).
+//		Section("*" + name + "*").
+//		Fields("*Current*\n<@U123>", "*Until*\nJan 02 15:04 UTC").
+//		Divider().
+//		Context("Updated every hour").
+//		Post(ctx, client, channel, threadTS)
+//
+// The returned reference can be used to update or delete the message later.
+type MessageBuilder struct {
+	text   string
+	blocks []chat.Block
+}
+
+// NewMessage returns a builder for a message with the given text, which is
+// shown in notifications and by clients that cannot render the blocks. A
+// message without blocks is a plain text message.
+func NewMessage(fmts string, args ...interface{}) *MessageBuilder {
+	return &MessageBuilder{text: fmt.Sprintf(fmts, args...)}
+}
+
+// Section adds a block of mrkdwn text.
+func (m *MessageBuilder) Section(text string) *MessageBuilder {
+	m.blocks = append(m.blocks, chat.SectionBlock{Text: text})
+	return m
+}
+
+// Fields adds the given mrkdwn fields, shown in two columns. They are added
+// to the last block if it is a section, otherwise to a new section, which is
+// split as needed to respect the Slack limits.
+func (m *MessageBuilder) Fields(fields ...string) *MessageBuilder {
+	for len(fields) > 0 {
+		s, ok := m.lastSection()
+		if !ok || len(s.Fields) >= maxSectionFields {
+			m.blocks = append(m.blocks, chat.SectionBlock{})
+			s = chat.SectionBlock{}
+		}
+		n := maxSectionFields - len(s.Fields)
+		if n > len(fields) {
+			n = len(fields)
+		}
+		s.Fields = append(s.Fields, fields[:n]...)
+		m.blocks[len(m.blocks)-1] = s
+		fields = fields[n:]
+	}
+	return m
+}
+
+// Accessory shows a button on the side of the last section. It is ignored if
+// the last block is not a section.
+func (m *MessageBuilder) Accessory(b chat.Button) *MessageBuilder {
+	if s, ok := m.lastSection(); ok {
+		s.Accessory = &b
+		m.blocks[len(m.blocks)-1] = s
+	}
+	return m
+}
+
+// Context adds a block of small, secondary mrkdwn text elements.
+func (m *MessageBuilder) Context(elements ...string) *MessageBuilder {
+	m.blocks = append(m.blocks, chat.ContextBlock{Elements: elements})
+	return m
+}
+
+// Divider adds a horizontal separator.
+func (m *MessageBuilder) Divider() *MessageBuilder {
+	m.blocks = append(m.blocks, chat.DividerBlock{})
+	return m
+}
+
+// Buttons adds a row of buttons.
+func (m *MessageBuilder) Buttons(buttons ...chat.Button) *MessageBuilder {
+	m.blocks = append(m.blocks, chat.ActionsBlock{Buttons: buttons})
+	return m
+}
+
+// Menus adds a row of drop-down menus.
+func (m *MessageBuilder) Menus(menus ...chat.Menu) *MessageBuilder {
+	m.blocks = append(m.blocks, chat.ActionsBlock{Menus: menus})
+	return m
+}
+
+// Input adds an input field. Inputs are only allowed in modal views, see
+// View.
+func (m *MessageBuilder) Input(in chat.InputBlock) *MessageBuilder {
+	m.blocks = append(m.blocks, in)
+	return m
+}
+
+func (m *MessageBuilder) lastSection() (chat.SectionBlock, bool) {
+	if len(m.blocks) == 0 {
+		return chat.SectionBlock{}, false
+	}
+	s, ok := m.blocks[len(m.blocks)-1].(chat.SectionBlock)
+	return s, ok
+}
+
+// Message returns the built message, to be posted to channel in the thread
+// threadTS, or on the main channel if threadTS is empty.
+func (m *MessageBuilder) Message(channel, threadTS string) *chat.OutgoingMessage {
+	return &chat.OutgoingMessage{
+		Channel:  channel,
+		ThreadTS: threadTS,
+		Text:     m.text,
+		Blocks:   append([]chat.Block(nil), m.blocks...),
+	}
+}
+
+// View returns a modal view with the built blocks. The text of the message
+// is the title of the view, and callbackID must be namespaced, see
+// plugins.Services.ActionID. If submit is empty the view cannot be
+// submitted.
+func (m *MessageBuilder) View(callbackID, submit string) *chat.View {
+	return &chat.View{
+		CallbackID: callbackID,
+		Title:      m.text,
+		Submit:     submit,
+		Close:      "Cancel",
+		Blocks:     append([]chat.Block(nil), m.blocks...),
+	}
+}
+
+// Post posts the message and returns a reference to it. Errors are logged
+// and returned.
+func (m *MessageBuilder) Post(ctx context.Context, client chat.Client, channel, threadTS string) (chat.MessageRef, error) {
+	ref, err := client.Post(ctx, m.Message(channel, threadTS))
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to post message: %v", err)
+	}
+	return ref, err
+}
+
+// PostEphemeral posts the message so that it is only visible to user. Errors
+// are logged and returned.
+func (m *MessageBuilder) PostEphemeral(ctx context.Context, client chat.Client, channel, threadTS, user string) error {
+	err := client.PostEphemeral(ctx, user, m.Message(channel, threadTS))
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to post ephemeral message: %v", err)
+	}
+	return err
+}
+
+// Update replaces the message identified by ref with the built message.
+// Errors are logged and returned.
+func (m *MessageBuilder) Update(ctx context.Context, client chat.Client, ref chat.MessageRef) error {
+	err := client.UpdateMessage(ctx, ref, m.Message(ref.Channel, ""))
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to update message: %v", err)
+	}
+	return err
+}
+
+// Button returns a button that sends value with the given action ID to the
+// plugin when clicked.
+func Button(actionID, text, value string) chat.Button {
+	return chat.Button{ActionID: actionID, Text: text, Value: value}
+}
+
+// LinkButton returns a button that opens url.
+func LinkButton(text, url string) chat.Button {
+	return chat.Button{Text: text, URL: url}
+}
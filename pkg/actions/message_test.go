@@ -0,0 +1,44 @@
+package actions
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	var fields []string
+	for i := 0; i < 12; i++ {
+		fields = append(fields, fmt.Sprintf("f%d", i))
+	}
+	page := Button("oncall/page", "Page", "U1")
+	msg := NewMessage("Oncall for %s", "sre").
+		Section("*sre*").
+		Fields(fields...).
+		Accessory(page).
+		Divider().
+		// ignored: the last block is not a section.
+		Accessory(page).
+		Context("Updated every hour").
+		Buttons(LinkButton("Runbook", "https://example.com/runbook")).
+		Message("C1", "123.456")
+
+	want := &chat.OutgoingMessage{
+		Channel:  "C1",
+		ThreadTS: "123.456",
+		Text:     "Oncall for sre",
+		Blocks: []chat.Block{
+			// sections have at most 10 fields.
+			chat.SectionBlock{Text: "*sre*", Fields: fields[:10]},
+			chat.SectionBlock{Fields: fields[10:], Accessory: &page},
+			chat.DividerBlock{},
+			chat.ContextBlock{Elements: []string{"Updated every hour"}},
+			chat.ActionsBlock{Buttons: []chat.Button{{Text: "Runbook", URL: "https://example.com/runbook"}}},
+		},
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("got message\n%+v\nwant\n%+v", msg, want)
+	}
+}
@@ -1,21 +1,20 @@
 package actions
 
 import (
+	"context"
 	"fmt"
-	"os"
 
-	"github.com/slack-go/slack"
-	"github.com/slack-go/slack/socketmode"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
 )
 
-// Say makes the bot speak on Slack.
-func Say(client *socketmode.Client, dest string, threadTS, fmts string, args ...interface{}) {
-	if _, _, err := client.PostMessage(
-		dest,
-		slack.MsgOptionText(fmt.Sprintf(fmts, args...), false),
-		// if threadTS is an empty string, the message is posted on the main channel/thread
-		slack.MsgOptionTS(threadTS),
-	); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to post message: %v\n", err)
+// Say makes the bot speak on Slack. Errors are logged and returned, so that
+// callers that need to know whether the message was delivered can check them.
+func Say(ctx context.Context, client chat.Client, dest string, threadTS, fmts string, args ...interface{}) error {
+	// if threadTS is an empty string, the message is posted on the main channel/thread
+	if _, err := client.PostMessage(ctx, dest, threadTS, fmt.Sprintf(fmts, args...)); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to post message: %v", err)
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/insomniacslk/slackbot/pkg/acl"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/sirupsen/logrus"
+)
+
+// errNotRunning is returned by the permission checks before the bot is
+// connected to Slack.
+var errNotRunning = errors.New("the bot is not running")
+
+// errDenied is returned for the interactions denied by the access control
+// rules.
+var errDenied = errors.New("access denied")
+
+// authorize checks the access control rules for a command handled by plugin.
+// If the command is denied, it replies to the user and writes an audit log
+// entry.
+func (b *Bot) authorize(ctx context.Context, client chat.Client, plugin *plugins.Instance, cmd *chat.Command) bool {
+	req := acl.Request{
+		User:       cmd.Message.User,
+		Channel:    cmd.Message.Channel,
+		Command:    cmd.Name,
+		Plugin:     plugin.Name(),
+		PluginType: plugin.Type,
+	}
+	if b.allowed(ctx, req) {
+		return true
+	}
+	b.reply(ctx, client, &cmd.Message, "Sorry <@%s>, you are not allowed to run `%s%s` here.", cmd.Message.User, b.Config().CmdPrefix, cmd.Name)
+	return false
+}
+
+// authorizeInteraction checks the access control rules for an interaction
+// with the blocks or the views of plugin. Interactions are not commands, so
+// only the rules that apply to all the commands or to the plugin apply. If
+// the interaction is denied, it tells the user with an ephemeral message
+// and writes an audit log entry.
+func (b *Bot) authorizeInteraction(ctx context.Context, client chat.Client, plugin *plugins.Instance, in *chat.Interaction) bool {
+	req := acl.Request{
+		User:       in.User,
+		Channel:    in.Channel,
+		Plugin:     plugin.Name(),
+		PluginType: plugin.Type,
+	}
+	if b.allowed(ctx, req) {
+		return true
+	}
+	if in.Channel == "" {
+		return false
+	}
+	threadTS := ""
+	if in.Message != nil {
+		threadTS = in.Message.ThreadTimestamp
+	}
+	msg := chat.OutgoingMessage{
+		Channel:  in.Channel,
+		ThreadTS: threadTS,
+		Text:     fmt.Sprintf("Sorry <@%s>, you are not allowed to use `%s` here.", in.User, plugin.Name()),
+	}
+	if err := client.PostEphemeral(ctx, in.User, &msg); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to report the denial: %v", err)
+	}
+	return false
+}
+
+// allowed evaluates the access control rules for req, and writes an audit
+// log entry if it is denied.
+func (b *Bot) allowed(ctx context.Context, req acl.Request) bool {
+	groups := b.groupResolver()
+	var (
+		decision acl.Decision
+		err      error
+	)
+	if groups == nil {
+		err = errNotRunning
+	} else {
+		decision, err = b.Config().Access.Authorize(ctx, groups, req)
+	}
+	if err == nil && decision.Allowed {
+		return true
+	}
+	log := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"audit":    true,
+		"decision": decision.String(),
+	})
+	if err != nil {
+		// e.g. a user group could not be resolved, because the
+		// usergroups:read scope is missing.
+		log.WithError(err).Errorf("Access denied, failed to evaluate the access rules")
+	} else {
+		log.Warnf("Access denied")
+	}
+	return false
+}
+
+// HasPermission returns true if the user who sent msg holds the named
+// permission in msg's channel, according to the `access` configuration.
+func (b *Bot) HasPermission(ctx context.Context, msg *chat.Message, permission string) (bool, error) {
+	groups := b.groupResolver()
+	if groups == nil {
+		return false, errNotRunning
+	}
+	ok, err := b.Config().Access.HasPermission(ctx, groups, msg.User, msg.Channel, permission)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{
+			"audit":      true,
+			"permission": permission,
+		}).WithError(err).Errorf("Permission denied, failed to evaluate the access rules")
+	}
+	return ok, err
+}
+
+// groupResolver returns the cache of the user group members, or nil if the
+// bot is not running.
+func (b *Bot) groupResolver() acl.GroupResolver {
+	if g := b.groups.Load(); g != nil {
+		return g
+	}
+	return nil
+}
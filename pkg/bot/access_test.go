@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/acl"
+	"github.com/insomniacslk/slackbot/pkg/credentials"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestAccessDenied(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	srv.AddUserGroup("sre", "U1")
+	cfg := Config{Access: acl.Config{
+		Default: acl.Deny,
+		Rules:   []acl.Rule{{Action: acl.Allow, Commands: []string{"echo"}, Subjects: acl.Subjects{UserGroups: []string{"sre"}}}},
+	}}
+	startBot(t, srv, &cfg, echoPlugin())
+
+	send(srv.SendMessage("C1", "U1", ".echo allowed"))
+	if p := expectPost(t, srv); p.Text != "echo: allowed" {
+		t.Errorf("got %q, want %q", p.Text, "echo: allowed")
+	}
+	send(srv.SendMessage("C1", "U2", ".echo denied"))
+	if p := expectPost(t, srv); !strings.Contains(p.Text, "not allowed") {
+		t.Errorf("got %q, want a denial", p.Text)
+	}
+}
+
+func TestAccessDeniedLogsGroupError(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	srv.Handle("usergroups.list", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok": false, "error": "missing_scope"}`))
+	})
+	hook := test.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+	cfg := Config{Access: acl.Config{
+		Rules: []acl.Rule{{Action: acl.Deny, Subjects: acl.Subjects{UserGroups: []string{"contractors"}}}},
+	}}
+	startBot(t, srv, &cfg, echoPlugin())
+
+	for _, text := range []string{".echo one", ".echo two"} {
+		send(srv.SendMessage("C1", "U1", text))
+		if p := expectPost(t, srv); !strings.Contains(p.Text, "not allowed") {
+			t.Errorf("got %q, want a denial", p.Text)
+		}
+	}
+	var denials int
+	for _, e := range hook.AllEntries() {
+		if e.Data["audit"] != true {
+			continue
+		}
+		denials++
+		if err, _ := e.Data[logrus.ErrorKey].(error); err == nil || !strings.Contains(err.Error(), "missing_scope") {
+			t.Errorf("got audit entry %q with error %v, want the group lookup error", e.Message, e.Data[logrus.ErrorKey])
+		}
+	}
+	if denials != 2 {
+		t.Errorf("got %d audit entries, want 2", denials)
+	}
+}
+
+func TestCheckUserGroupScope(t *testing.T) {
+	srv := newServer(t)
+	cfg := Config{
+		SlackAPIURL: srv.APIURL(),
+		Credentials: credentials.Credentials{SlackAppLevelToken: "xapp-test"},
+		Access:      acl.Config{Permissions: map[string]acl.Subjects{"write": {UserGroups: []string{"sre"}}}},
+	}
+	report := New(&cfg).Check(context.Background())
+	if got := report.Requirements[0].Missing; len(got) != 1 || got[0] != "usergroups:read" {
+		t.Errorf("got missing scopes %q, want usergroups:read", got)
+	}
+}
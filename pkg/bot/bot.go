@@ -1,122 +1,594 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 
-	"github.com/insomniacslk/slackbot/pkg/credentials"
+	"github.com/insomniacslk/slackbot/pkg/acl"
+	"github.com/insomniacslk/slackbot/pkg/actions"
+	"github.com/insomniacslk/slackbot/pkg/bot/cmdline"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/insomniacslk/slackbot/pkg/metrics"
+	"github.com/insomniacslk/slackbot/pkg/outbound"
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/sirupsen/logrus"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 )
 
 func New(c *Config) *Bot {
-	return &Bot{
-		Name:   c.BotName,
-		Config: c,
+	b := Bot{
+		Log:     logrus.WithField("bot", c.BotName),
+		Name:    c.BotName,
+		Metrics: metrics.NewRegistry(),
 	}
+	b.metrics = newBotMetrics(b.Metrics)
+	b.replies = newReplyTracker()
+	b.config.Store(c)
+	return &b
 }
 
 // Bot is the main bot object.
 type Bot struct {
-	Log    *log.Logger
-	Name   string
-	Config *Config
+	// Log is the bot's logger. Run configures the standard logger it writes
+	// to according to Config.Log.
+	Log  *logrus.Entry
+	Name string
+	// Metrics holds the bot and plugin metrics, served on Config.HTTPAddr.
+	Metrics *metrics.Registry
+
+	// config is replaced atomically when the configuration is reloaded.
+	config atomic.Pointer[Config]
+	// reloadMu protects the following fields, which are set by Run, and
+	// serializes the configuration reloads.
+	reloadMu sync.Mutex
+	// runCtx is the context passed to Run, which is passed to the plugins
+	// started by a configuration reload.
+	runCtx     context.Context
+	chat       chat.Client
+	store      storage.Store
+	outbound   *outbound.Queue
+	dispatcher *dispatcher
+
+	metrics *botMetrics
+	// selfID and selfBotID are the user ID and the bot ID of the bot, set by
+	// Run before connecting. They are empty if the self-check could not get
+	// them.
+	selfID    string
+	selfBotID string
+	// replies maps the recent command messages to the bot replies.
+	replies *replyTracker
+	// dedupe remembers the handled events. It is set by Run before
+	// connecting.
+	dedupe *deduper
+	// connectedOnce is true after the first Socket Mode connection. It is
+	// only used by the event loop.
+	connectedOnce bool
+	// groups caches the members of the user groups used by the access
+	// rules. It is nil until Run connects to Slack.
+	groups atomic.Pointer[acl.GroupCache]
+	// the following fields are reported by the health checks.
+	connected      atomic.Bool
+	pluginsStarted atomic.Bool
+	lastHeartbeat  atomic.Int64
+}
+
+// Config returns the current configuration of the bot.
+func (b *Bot) Config() *Config {
+	return b.config.Load()
+}
+
+func (b *Bot) isCmd(cmd string) bool {
+	prefix := b.Config().CmdPrefix
+	return strings.HasPrefix(cmd, prefix) && len(cmd)-len(prefix) > 0
+}
+
+// splitCmd splits a message text in the command name, including the command
+// prefix, and the rest of the line. Any white space, including tabs and
+// newlines, separates the command from its arguments.
+func splitCmd(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	idx := strings.IndexFunc(text, unicode.IsSpace)
+	if idx == -1 {
+		return text, ""
+	}
+	return text[:idx], strings.TrimSpace(text[idx:])
+}
+
+// reply posts a message in the same thread as msg.
+func (b *Bot) reply(ctx context.Context, client chat.Client, msg *chat.Message, fmts string, args ...interface{}) {
+	actions.Say(ctx, client, msg.Channel, msg.ThreadTimestamp, fmts, args...)
+}
+
+// threadKey returns the key used to preserve the ordering of the commands
+// issued in the same thread. A top-level message starts its own thread, so
+// the commands sent on the main channel run concurrently.
+func threadKey(msg *chat.Message) string {
+	ts := msg.ThreadTimestamp
+	if ts == "" {
+		ts = msg.Timestamp
+	}
+	return msg.Channel + "/" + ts
+}
+
+// commandKey returns the dispatch key of a command. Slash commands have no
+// message timestamp, so every invocation gets its own key.
+func commandKey(command *chat.Command) string {
+	if command.Slash != "" {
+		return "slash/" + command.TriggerID
+	}
+	return threadKey(&command.Message)
+}
+
+// handleMessage parses a message and, if it is a command, dispatches it to
+// the plugins that handle it on the worker pool. Otherwise it is passed to
+// the message listeners.
+func (b *Bot) handleMessage(client chat.Client, ev *slackevents.MessageEvent) {
+	switch ev.SubType {
+	case "message_changed":
+		b.handleEdit(client, ev)
+		return
+	case "message_deleted":
+		b.handleDeletion(client, ev)
+		return
+	}
+	if reason := b.ignoreMessage(ev.User, ev.BotID, ev.SubType); reason != "" {
+		b.metrics.ignoredEvents.Inc(reason)
+		return
+	}
+	if command, ok := b.parseCommand(ev, false); ok {
+		b.dispatchCommand(client, command)
+		return
+	}
+	b.handleListeners(client, ev)
+}
+
+// parseCommand returns the command sent in a message, if any. If mention is
+// true, a message starting with a mention of the bot is a command too.
+func (b *Bot) parseCommand(ev *slackevents.MessageEvent, mention bool) (chat.Command, bool) {
+	if ev.ChannelType == chat.ChannelDirect && !b.Config().DisableDirectMessages {
+		return b.parseDirectMessage(ev)
+	}
+	text, mentioned := ev.Text, false
+	if mention {
+		if t, ok := b.stripMention(text); ok {
+			text, mentioned = t, true
+		}
+	}
+	name, arg := splitCmd(text)
+	switch {
+	case b.isCmd(name):
+		name = name[len(b.Config().CmdPrefix):]
+	case !mentioned:
+		return chat.Command{}, false
+	}
+	return chat.Command{
+		Name:        name,
+		Arg:         arg,
+		Message:     messageFromEvent(ev),
+		Mention:     mentioned,
+		ChannelType: ev.ChannelType,
+	}, true
 }
 
-func (b Bot) isCmd(cmd string) bool {
-	return strings.HasPrefix(cmd, b.Config.CmdPrefix) && len(cmd)-len(b.Config.CmdPrefix) > 0
+// dispatchCommand runs a command on the worker pool, replying through client.
+func (b *Bot) dispatchCommand(client chat.Client, command chat.Command) {
+	cfg := b.Config()
+	cmd := command.Name
+	fields := logrus.Fields{
+		"command":   cmd,
+		"user":      command.Message.User,
+		"channel":   command.Message.Channel,
+		"thread_ts": command.Message.ThreadTimestamp,
+	}
+	if command.Slash != "" {
+		fields["slash_command"] = command.Slash
+	}
+	if command.Mention {
+		fields["mention"] = true
+	}
+	if command.ChannelType != "" {
+		fields["channel_type"] = command.ChannelType
+	}
+	log := b.Log.WithFields(fields)
+	log.Debugf("Received command with arg %q", command.Arg)
+	// the replies are tracked to update them if the command is edited.
+	rc := b.replyClient(client, &command.Message)
+	if rc != nil {
+		client = rc
+	}
+	// the views opened by the command remember where they come from.
+	client = viewClient{Client: client, b: b, origin: &command.Message}
+	j := job{
+		run: func(ctx context.Context) {
+			ctx = logging.NewContext(ctx, log)
+			rc.start()
+			b.runCommand(ctx, client, &command)
+			rc.finish(ctx)
+		},
+		onTimeout: func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			b.reply(ctx, client, &command.Message, "Sorry, `%s%s` took too long and was cancelled.", cfg.CmdPrefix, cmd)
+		},
+		timeout: cfg.CommandTimeout,
+	}
+	if !b.dispatcher.dispatch(commandKey(&command), j) {
+		log.Warnf("Too many pending commands, dropping command")
+		// do not block the event loop while the reply is delivered.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			b.reply(ctx, client, &command.Message, "Sorry, I'm too busy right now, try again later.")
+		}()
+	}
 }
 
-// Start starts the bot.
+// runCommand runs a command with all the plugins that handle it.
+func (b *Bot) runCommand(ctx context.Context, client chat.Client, command *chat.Command) {
+	args, parseErr := cmdline.ParseLine(command.Arg)
+	command.Args = args
+	switch {
+	case command.Name == HelpCmd:
+		b.reply(ctx, client, &command.Message, "%s", b.help(command.Arg))
+		return
+	case command.Mention && command.Name == "":
+		b.reply(ctx, client, &command.Message, "%s", b.mentionHelp())
+		return
+	case addressed(command) && !b.handled(command.Name):
+		// the user is talking to the bot, do not ignore them.
+		b.reply(ctx, client, &command.Message, "Sorry, I don't know `%s`. %s", command.Name, b.helpHint(command))
+		return
+	}
+	for _, plugin := range b.Config().Plugins {
+		if !plugin.Handles(command.Name) {
+			continue
+		}
+		log := logging.FromContext(ctx).WithField("plugin", plugin.Name())
+		pctx := logging.NewContext(ctx, log)
+		if !b.authorize(pctx, client, plugin, command) {
+			b.metrics.commands.Inc(plugin.Name(), outcomeDenied)
+			continue
+		}
+		if parseErr != nil {
+			b.metrics.commands.Inc(plugin.Name(), outcomeUsage)
+			log.Infof("Invalid usage: %v", parseErr)
+			b.replyUsage(pctx, client, plugin, command, parseErr)
+			return
+		}
+		log.Debugf("Handling command with arg %q", command.Arg)
+		start := time.Now()
+		err := b.invoke(pctx, plugin, client, command)
+		b.metrics.commandDuration.Observe(time.Since(start).Seconds(), plugin.Name())
+		var perr *PanicError
+		switch {
+		case err == nil:
+			b.metrics.commands.Inc(plugin.Name(), outcomeOK)
+		case errors.Is(err, plugins.ErrUsage):
+			b.metrics.commands.Inc(plugin.Name(), outcomeUsage)
+			log.Infof("Invalid usage: %v", err)
+			b.replyUsage(pctx, client, plugin, command, err)
+		case ctx.Err() == context.DeadlineExceeded:
+			// the user was already told that the command timed out.
+			b.metrics.commands.Inc(plugin.Name(), outcomeTimeout)
+			log.Errorf("Command timed out: %v", err)
+		case errors.As(err, &perr):
+			b.metrics.commands.Inc(plugin.Name(), outcomePanic)
+			b.replyError(pctx, client, plugin, command, err)
+		default:
+			b.metrics.commands.Inc(plugin.Name(), outcomeError)
+			b.replyError(pctx, client, plugin, command, err)
+		}
+	}
+}
+
+// Start starts the bot and blocks until the connection to Slack fails.
 func (b *Bot) Start() error {
-	logger := log.New(
-		os.Stdout,
-		fmt.Sprintf("%s: ", b.Name),
-		log.Lshortfile|log.LstdFlags,
-	)
-	if b.Config.LogFile != "" {
-		fd, err := os.OpenFile(b.Config.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	return b.Run(context.Background())
+}
+
+// Run starts the bot and blocks until ctx is cancelled or the connection to
+// Slack fails. When ctx is cancelled the bot stops accepting new events,
+// waits up to Config.ShutdownTimeout for the running commands to complete,
+// and stops the plugins.
+func (b *Bot) Run(ctx context.Context) error {
+	logConfig := b.Config().Log
+	if logConfig.Level == "" {
+		// not validated
+		if err := logConfig.Validate(); err != nil {
+			return err
+		}
+	}
+	closeLog, err := logging.Setup(logrus.StandardLogger(), logConfig)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	defer func() {
+		if err := closeLog.Close(); err != nil {
+			logrus.Errorf("Failed to close log file: %v", err)
+		}
+	}()
+
+	b.Log.Debugf("Config: %+v", b.Config())
+	report := b.Check(ctx)
+	if !report.OK() {
+		b.Log.Warnf("Self-check found problems:\n%s", report)
+	} else {
+		b.Log.Infof("Self-check passed:\n%s", report)
+	}
+	b.selfID, b.selfBotID = report.UserID, report.BotID
+	if addr := b.Config().HTTPAddr; addr != "" {
+		shutdownHTTP, err := b.serveHTTP(addr)
 		if err != nil {
-			return fmt.Errorf("Failed to open log file `%s`: %v", b.Config.LogFile, err)
+			return err
 		}
-		log.SetOutput(fd)
-		fmt.Printf("Logging to file %s\n", b.Config.LogFile)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownHTTP(ctx); err != nil {
+				b.Log.Errorf("Failed to shut down the HTTP server: %v", err)
+			}
+		}()
 	}
-	b.Log = logger
+	slackLog := b.slackLogger()
+	api := b.newSlackAPI()
+	client := socketmode.New(api, socketmode.OptionDebug(b.Config().Debug), socketmode.OptionLog(slackLog))
+	var apiClient chat.Client = instrumentedClient{client: chat.NewSlackClient(api), m: b.metrics}
+	b.Log.Debugf("Client created")
 
-	b.Log.Printf("Config: %+v", b.Config)
-	api := slack.New(credentials.SlackBotToken, slack.OptionDebug(b.Config.Debug), slack.OptionLog(b.Log), slack.OptionAppLevelToken(credentials.SlackAppLevelToken))
-	client := socketmode.New(api, socketmode.OptionDebug(b.Config.Debug), socketmode.OptionLog(b.Log))
-	b.Log.Printf("Client created")
+	store, closeStore, err := b.openStorage()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeStore(); err != nil {
+			b.Log.Errorf("Failed to close storage: %v", err)
+		}
+	}()
+	outboundConfig := b.Config().Outbound
+	if err := outboundConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid outbound configuration: %w", err)
+	}
+	queue := outbound.New(apiClient, store, b.Log.WithField("component", "outbound"), b.Metrics, outboundConfig)
+	// messages are posted through the queue, the other calls go directly to
+	// the API.
+	chatClient := queue.Client()
+	b.reloadMu.Lock()
+	b.runCtx = ctx
+	b.chat = chatClient
+	b.store = store
+	b.outbound = queue
+	b.groups.Store(acl.NewGroupCache(apiClient, 0))
+	cfg := b.Config()
+	if err := b.startPlugins(ctx, cfg, cfg.Plugins); err != nil {
+		b.reloadMu.Unlock()
+		stopCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout())
+		defer cancel()
+		b.stopOutbound(stopCtx)
+		return err
+	}
+	b.pluginsStarted.Store(true)
+	b.reloadMu.Unlock()
+	b.pruneViews(ctx)
+	b.dedupe = newDeduper(ctx, cfg.Dedupe, store, b.Log.WithField("component", "dedupe"))
+
+	workers, timeout := b.Config().Workers, b.Config().CommandTimeout
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	b.dispatcher = newDispatcher(workers, DefaultQueueSize, timeout)
+	// commands are not cancelled by ctx, so that they can complete during
+	// shutdown.
+	b.dispatcher.start(context.Background())
 
+	clientCtx, cancelClient := context.WithCancel(context.Background())
+	defer cancelClient()
+	runErr := make(chan error, 1)
 	go func() {
-		for ev := range client.Events {
-			switch ev.Type {
-			case socketmode.EventTypeConnecting:
-				fmt.Println("Connecting to Slack with Socket Mode...")
-			case socketmode.EventTypeConnectionError:
-				fmt.Println("Connection failed. Retrying later...")
-			case socketmode.EventTypeConnected:
-				fmt.Println("Connected to Slack with Socket Mode.")
-			case socketmode.EventTypeEventsAPI:
-				eventsAPIEvent, ok := ev.Data.(slackevents.EventsAPIEvent)
-				if !ok {
-					fmt.Printf("Ignored %+v\n", ev)
-					continue
-				}
-				fmt.Printf("Event received: %T %v %+v\n", eventsAPIEvent, eventsAPIEvent.Type, eventsAPIEvent)
-				client.Ack(*ev.Request)
-				switch eventsAPIEvent.Type {
-				case slackevents.CallbackEvent:
-					innerEvent := eventsAPIEvent.InnerEvent
-					switch iev := innerEvent.Data.(type) {
-					case *slackevents.AppMentionEvent:
-						_, _, err := client.PostMessage(iev.Channel, slack.MsgOptionText("Yes, hello.", false))
-						if err != nil {
-							fmt.Printf("failed posting message: %v\n", err)
-						}
-						fmt.Printf("Posted reply to %v", iev.Channel)
-					case *slackevents.MemberJoinedChannelEvent:
-						fmt.Printf("user %q joined to channel %q\n", iev.User, iev.Channel)
-					case *slackevents.MessageEvent:
-						parts := strings.SplitN(iev.Text, " ", 2)
-						if len(parts) == 0 {
-							// blank line?
-							continue
-						}
-						if !b.isCmd(parts[0]) {
-							continue
-						}
-						cmd := parts[0][len(b.Config.CmdPrefix):]
-						var arg string
-						if len(parts) == 1 {
-							arg = ""
-						} else {
-							arg = parts[1]
-						}
-						log.Printf("Received command %q with arg %q", cmd, arg)
-						for _, plugin := range b.Config.Plugins {
-							if plugin.Handles(cmd) {
-								log.Printf("Plugin %q handling command %q with arg %q", plugin.Name(), cmd, arg)
-								if err := plugin.HandleCmd(client, iev, strings.TrimSpace(arg)); err != nil {
-									b.Log.Printf("Error: plugin %s: %v", plugin.Name(), err)
-								}
-							}
-						}
-					default:
-						fmt.Printf("Unhandled inner event: %T %+v\n", iev, iev)
-					}
-				default:
-					fmt.Printf("Unsupported event: %v\n", eventsAPIEvent.Type)
-					client.Debugf("unsupported Events API event received")
-				}
+		runErr <- client.RunContext(clientCtx)
+	}()
+
+	heartbeat := time.NewTicker(DefaultHeartbeatInterval)
+	defer heartbeat.Stop()
+	b.heartbeat()
+	clientDone := false
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case err = <-runErr:
+			clientDone = true
+			break loop
+		case <-heartbeat.C:
+			b.heartbeat()
+		case ev := <-client.Events:
+			b.heartbeat()
+			b.handleEvent(client, chatClient, ev)
+		}
+	}
+
+	b.Log.Infof("Shutting down")
+	b.connected.Store(false)
+	b.pluginsStarted.Store(false)
+	cancelClient()
+	if !clientDone {
+		// keep draining the events until the client returns, otherwise it
+		// may block forever trying to deliver them.
+	drain:
+		for {
+			select {
+			case <-client.Events:
+			case <-runErr:
+				break drain
+			}
+		}
+	}
+	b.shutdown()
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return err
+}
+
+// slackLogger returns the logger passed to the Slack client.
+func (b *Bot) slackLogger() *log.Logger {
+	return logging.StdLogger(b.Log.WithField("component", "slack"), logrus.DebugLevel)
+}
+
+// newSlackAPI returns a Slack web API client configured with the bot's
+// credentials and the given additional options.
+func (b *Bot) newSlackAPI(extra ...slack.Option) *slack.Client {
+	cfg := b.Config()
+	opts := []slack.Option{
+		slack.OptionDebug(cfg.Debug),
+		slack.OptionLog(b.slackLogger()),
+		slack.OptionAppLevelToken(cfg.Credentials.SlackAppLevelToken.Value()),
+	}
+	if cfg.SlackAPIURL != "" {
+		opts = append(opts, slack.OptionAPIURL(cfg.SlackAPIURL))
+	}
+	return slack.New(cfg.Credentials.SlackBotToken.Value(), append(opts, extra...)...)
+}
+
+// shutdown waits for the running commands to complete, up to
+// Config.ShutdownTimeout, then stops the plugins and delivers the pending
+// messages.
+func (b *Bot) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Config().shutdownTimeout())
+	defer cancel()
+	if err := b.dispatcher.stop(ctx); err != nil {
+		b.Log.Errorf("Running commands did not complete in time, cancelled them: %v", err)
+	}
+	stopPlugins(ctx, b.Config().Plugins, b.Log)
+	b.stopOutbound(ctx)
+	b.Log.Infof("Shutdown complete")
+}
+
+// stopOutbound waits for the pending messages to be delivered, or for ctx to
+// be done.
+func (b *Bot) stopOutbound(ctx context.Context) {
+	if err := b.outbound.Stop(ctx); err != nil {
+		b.Log.Errorf("Pending messages were not delivered in time, recorded them as failed: %v", err)
+	}
+}
+
+// handleEvent handles a single Socket Mode event.
+func (b *Bot) handleEvent(client *socketmode.Client, chatClient chat.Client, ev socketmode.Event) {
+	b.metrics.events.Inc(eventType(ev))
+	switch ev.Type {
+	case socketmode.EventTypeConnecting:
+		b.Log.Infof("Connecting to Slack with Socket Mode...")
+		if b.connectedOnce {
+			b.metrics.reconnects.Inc()
+		}
+		b.setConnected(false)
+	case socketmode.EventTypeConnectionError, socketmode.EventTypeInvalidAuth:
+		b.Log.Warnf("Connection failed. Retrying later...")
+		b.setConnected(false)
+	case socketmode.EventTypeDisconnect:
+		b.Log.Infof("Disconnect requested by Slack, reconnecting...")
+		b.setConnected(false)
+	case socketmode.EventTypeConnected:
+		b.Log.Infof("Connected to Slack with Socket Mode.")
+		b.connectedOnce = true
+		b.setConnected(true)
+	case socketmode.EventTypeEventsAPI:
+		eventsAPIEvent, ok := ev.Data.(slackevents.EventsAPIEvent)
+		if !ok {
+			b.Log.Debugf("Ignored %+v", ev)
+			return
+		}
+		b.Log.Debugf("Event received: %T %v %+v", eventsAPIEvent, eventsAPIEvent.Type, eventsAPIEvent)
+		client.Ack(*ev.Request)
+		if ev.Request.RetryAttempt > 0 {
+			b.Log.Infof("Event redelivered by Slack (attempt %d: %s)", ev.Request.RetryAttempt, ev.Request.RetryReason)
+		}
+		switch eventsAPIEvent.Type {
+		case slackevents.CallbackEvent:
+			if b.dedupe.seen(context.Background(), eventKeys(&eventsAPIEvent)...) {
+				b.Log.Infof("Ignoring duplicate %s event", eventsAPIEvent.InnerEvent.Type)
+				b.metrics.ignoredEvents.Inc(ignoreDuplicate)
+				return
+			}
+			innerEvent := eventsAPIEvent.InnerEvent
+			switch iev := innerEvent.Data.(type) {
+			case *slackevents.AppMentionEvent:
+				b.handleMention(chatClient, iev)
+			case *slackevents.MemberJoinedChannelEvent:
+				b.Log.Infof("User %q joined to channel %q", iev.User, iev.Channel)
+			case *slackevents.MessageEvent:
+				b.handleMessage(chatClient, iev)
 			default:
-				fmt.Printf("Event: %T %+v\n", ev, ev)
+				b.Log.Debugf("Inner event: %T %+v", iev, iev)
 			}
+			b.handleSubscriptions(chatClient, &eventsAPIEvent)
+		default:
+			b.Log.Debugf("Unsupported Events API event: %v", eventsAPIEvent.Type)
 		}
-	}()
-	return client.Run()
+	case socketmode.EventTypeSlashCommand:
+		sc, ok := ev.Data.(slack.SlashCommand)
+		if !ok {
+			b.Log.Debugf("Ignored %+v", ev)
+			return
+		}
+		b.Log.Debugf("Slash command received: %s %q", sc.Command, sc.Text)
+		if _, ok := b.Config().SlashCommands[sc.Command]; !ok {
+			b.Log.Warnf("Slash command %s is not configured", sc.Command)
+			// the payload of the acknowledgement is shown to the user.
+			client.Ack(*ev.Request, map[string]interface{}{
+				"text": fmt.Sprintf("Sorry, `%s` is not configured.", sc.Command),
+			})
+			return
+		}
+		// acknowledge immediately, Slack shows an error if the command is
+		// not acknowledged within 3 seconds. The responses are sent to the
+		// response URL.
+		client.Ack(*ev.Request)
+		b.handleSlashCommand(chatClient, sc)
+	case socketmode.EventTypeInteractive:
+		cb, ok := ev.Data.(slack.InteractionCallback)
+		if !ok {
+			b.Log.Debugf("Ignored %+v", ev)
+			return
+		}
+		b.Log.Debugf("Interaction received: %s", cb.Type)
+		b.handleInteraction(client, chatClient, ev.Request, &cb)
+	default:
+		b.Log.Debugf("Event: %T %+v", ev, ev)
+	}
+}
+
+// setConnected records the state of the Socket Mode connection.
+func (b *Bot) setConnected(connected bool) {
+	b.connected.Store(connected)
+	if connected {
+		b.metrics.connected.Set(1)
+	} else {
+		b.metrics.connected.Set(0)
+	}
+}
+
+// messageFromEvent converts a Slack message event to a chat.Message.
+func messageFromEvent(ev *slackevents.MessageEvent) chat.Message {
+	return chat.Message{
+		Channel:         ev.Channel,
+		User:            ev.User,
+		Text:            ev.Text,
+		Timestamp:       ev.TimeStamp,
+		ThreadTimestamp: ev.ThreadTimeStamp,
+	}
 }
@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/slack-go/slack"
+)
+
+// RequiredScopes are the Slack OAuth scopes needed by the bot itself,
+// regardless of the loaded plugins. The history scopes are needed to receive
+// the prefixed commands sent in public and private channels.
+var RequiredScopes = []string{"app_mentions:read", "channels:history", "chat:write", "groups:history"}
+
+// CheckResult is the result of a single self-check.
+type CheckResult struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// ScopeRequirements reports the Slack OAuth scopes required by the bot or by
+// a plugin instance, and those of them that were not granted.
+type ScopeRequirements struct {
+	// Name is "bot" or "plugin <instance name>".
+	Name     string
+	Required []string
+	Missing  []string
+}
+
+// CheckReport is the outcome of the self-check.
+type CheckReport struct {
+	Checks []CheckResult
+	// UserID and BotID are the user ID and the bot ID of the bot, empty if
+	// unknown.
+	UserID string
+	BotID  string
+	// Scopes are the OAuth scopes granted to the bot token, nil if unknown.
+	Scopes       []string
+	Requirements []ScopeRequirements
+}
+
+// OK returns true if all the checks passed and no required scope is missing.
+func (r *CheckReport) OK() bool {
+	for _, c := range r.Checks {
+		if !c.OK {
+			return false
+		}
+	}
+	for _, p := range r.Requirements {
+		if len(p.Missing) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *CheckReport) String() string {
+	var lines []string
+	for _, c := range r.Checks {
+		status := "OK"
+		if !c.OK {
+			status = "FAIL"
+		}
+		lines = append(lines, fmt.Sprintf("[%4s] %s: %s", status, c.Name, c.Detail))
+	}
+	if r.Scopes != nil {
+		lines = append(lines, "Granted scopes: "+strings.Join(r.Scopes, ", "))
+	}
+	for _, p := range r.Requirements {
+		line := fmt.Sprintf("The %s requires %s", p.Name, strings.Join(p.Required, ", "))
+		switch {
+		case len(p.Missing) > 0:
+			line += ", missing " + strings.Join(p.Missing, ", ")
+		case r.Scopes != nil:
+			line += ", all granted"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// scopeRecorder is an HTTP client that records the OAuth scopes returned by
+// Slack in the X-OAuth-Scopes header.
+type scopeRecorder struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	scopes string
+}
+
+func (s *scopeRecorder) Do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err == nil {
+		if h := resp.Header.Get("X-OAuth-Scopes"); h != "" {
+			s.mu.Lock()
+			s.scopes = h
+			s.mu.Unlock()
+		}
+	}
+	return resp, err
+}
+
+func (s *scopeRecorder) granted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scopes == "" {
+		return nil
+	}
+	var scopes []string
+	for _, scope := range strings.Split(s.scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// Check verifies the Slack bot token and its granted scopes, the Slack
+// app-level token, and the PagerDuty API key, and reports the scopes required
+// by the bot and each loaded plugin.
+func (b *Bot) Check(ctx context.Context) *CheckReport {
+	cfg := b.Config()
+	var report CheckReport
+	rec := scopeRecorder{client: &http.Client{Timeout: DefaultHTTPTimeout}}
+	api := b.newSlackAPI(slack.OptionHTTPClient(&rec))
+
+	if resp, err := api.AuthTestContext(ctx); err != nil {
+		report.add("Slack bot token", false, fmt.Sprintf("auth.test failed: %v", err))
+	} else {
+		report.add("Slack bot token", true, fmt.Sprintf("authenticated as %s (%s) in team %s", resp.User, resp.UserID, resp.Team))
+		report.UserID, report.BotID = resp.UserID, resp.BotID
+		report.Scopes = rec.granted()
+	}
+	if cfg.Credentials.SlackAppLevelToken == "" {
+		report.add("Slack app-level token", false, "not set, it is required for Socket Mode")
+	} else if _, _, err := api.StartSocketModeContext(ctx); err != nil {
+		report.add("Slack app-level token", false, fmt.Sprintf("cannot open a Socket Mode connection: %v", err))
+	} else {
+		report.add("Slack app-level token", true, "can open a Socket Mode connection")
+	}
+	if cfg.Credentials.PagerDutyAPIKey == "" {
+		report.add("PagerDuty API key", true, "not set, skipped")
+	} else {
+		pd := pagerduty.NewClient(cfg.Credentials.PagerDutyAPIKey.Value())
+		pd.HTTPClient = rec.client
+		if _, err := pd.ListAbilitiesWithContext(ctx); err != nil {
+			report.add("PagerDuty API key", false, fmt.Sprintf("cannot list abilities: %v", err))
+		} else {
+			report.add("PagerDuty API key", true, "valid")
+		}
+	}
+
+	required := append([]string(nil), RequiredScopes...)
+	if len(cfg.SlashCommands) > 0 {
+		required = append(required, "commands")
+	}
+	if !cfg.DisableDirectMessages {
+		required = append(required, "im:history")
+	}
+	if cfg.Access.UsesUserGroups() {
+		required = append(required, "usergroups:read")
+	}
+	report.addScopes("bot", required)
+	for _, p := range cfg.Plugins {
+		if sr, ok := p.Plugin.(plugins.ScopeRequirer); ok {
+			report.addScopes("plugin "+p.Name(), sr.RequiredScopes())
+		}
+	}
+	return &report
+}
+
+func (r *CheckReport) add(name string, ok bool, detail string) {
+	r.Checks = append(r.Checks, CheckResult{Name: name, OK: ok, Detail: detail})
+}
+
+// addScopes records the scopes required by name, and the missing ones if the
+// granted scopes are known.
+func (r *CheckReport) addScopes(name string, required []string) {
+	ps := ScopeRequirements{Name: name, Required: required}
+	if r.Scopes != nil {
+		granted := make(map[string]bool, len(r.Scopes))
+		for _, s := range r.Scopes {
+			granted[s] = true
+		}
+		for _, s := range required {
+			if !granted[s] {
+				ps.Missing = append(ps.Missing, s)
+			}
+		}
+	}
+	r.Requirements = append(r.Requirements, ps)
+}
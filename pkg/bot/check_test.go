@@ -0,0 +1,29 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/credentials"
+)
+
+func TestCheckScopes(t *testing.T) {
+	srv := newServer(t)
+	srv.Scopes = []string{"app_mentions:read", "chat:write", "im:history"}
+	cfg := Config{SlackAPIURL: srv.APIURL(), Credentials: credentials.Credentials{SlackAppLevelToken: "xapp-test"}}
+	report := New(&cfg).Check(context.Background())
+	if report.UserID != srv.BotUserID || report.BotID != srv.BotID {
+		t.Errorf("got bot %s/%s, want %s/%s", report.UserID, report.BotID, srv.BotUserID, srv.BotID)
+	}
+	if len(report.Requirements) != 1 {
+		t.Fatalf("got requirements %+v, want only the bot's", report.Requirements)
+	}
+	want := []string{"channels:history", "groups:history"}
+	if got := report.Requirements[0].Missing; !reflect.DeepEqual(got, want) {
+		t.Errorf("got missing scopes %q, want %q", got, want)
+	}
+	if report.OK() {
+		t.Errorf("report OK with missing scopes")
+	}
+}
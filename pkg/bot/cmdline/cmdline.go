@@ -0,0 +1,246 @@
+// Package cmdline parses the arguments of bot commands.
+//
+// A command line is split into words like a shell would, honoring single and
+// double quotes and backslash escapes. Words starting with `--` are flags, in
+// the form `--name=value` or `--name value`; a flag that is the last word or
+// is followed by another flag has an empty value, and is considered a boolean
+// flag set to true. A lone `--` stops flag parsing. All the other words are
+// positional arguments, the first of which can be used as a subcommand.
+package cmdline
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrUsage means that a command was invoked with invalid arguments.
+var ErrUsage = errors.New("invalid usage")
+
+// UsageError describes why a command line is invalid. It wraps ErrUsage.
+type UsageError struct {
+	Msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns ErrUsage.
+func (e *UsageError) Unwrap() error {
+	return ErrUsage
+}
+
+// Usagef returns a new UsageError with the formatted message.
+func Usagef(format string, args ...interface{}) error {
+	return &UsageError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Split splits a command line into words. Words are separated by any amount
+// of white space, including tabs and newlines. Single quotes preserve their
+// content literally, double quotes allow backslash escapes, and outside of
+// quotes a backslash escapes the next character.
+//
+// Quotes only start a quoted string at the beginning of a word or after `=`,
+// e.g. `--name="a b"`, so apostrophes in plain text such as "it's" are
+// literal. A trailing backslash is literal too. A quote that is never closed
+// is a UsageError.
+func Split(line string) ([]string, error) {
+	var (
+		words   []string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+		prev    rune
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case (r == '"' || r == '\'') && (!inWord || prev == '='):
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+		prev = r
+	}
+	if quote != 0 {
+		return nil, Usagef("unterminated %c quote", quote)
+	}
+	if escaped {
+		cur.WriteRune('\\')
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// Args holds the positional arguments and flags of a command.
+type Args struct {
+	positional []string
+	flags      map[string][]string
+}
+
+// Parse parses words as returned by Split into an Args. Flags listed in
+// boolFlags never consume the following word as their value, so they can be
+// placed before positional arguments.
+func Parse(words []string, boolFlags ...string) *Args {
+	isBool := make(map[string]bool, len(boolFlags))
+	for _, name := range boolFlags {
+		isBool[name] = true
+	}
+	a := Args{flags: make(map[string][]string)}
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if w == "--" {
+			a.positional = append(a.positional, words[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(w, "--") {
+			a.positional = append(a.positional, w)
+			continue
+		}
+		name, value, hasValue := strings.Cut(w[2:], "=")
+		if !hasValue && !isBool[name] && i+1 < len(words) && !strings.HasPrefix(words[i+1], "--") {
+			value = words[i+1]
+			i++
+		}
+		a.flags[name] = append(a.flags[name], value)
+	}
+	return &a
+}
+
+// ParseLine is a shortcut for Split followed by Parse.
+func ParseLine(line string, boolFlags ...string) (*Args, error) {
+	words, err := Split(line)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(words, boolFlags...), nil
+}
+
+// NArg returns the number of positional arguments.
+func (a *Args) NArg() int {
+	return len(a.positional)
+}
+
+// Arg returns the i-th positional argument, or an empty string if there are
+// not enough arguments.
+func (a *Args) Arg(i int) string {
+	if i < 0 || i >= len(a.positional) {
+		return ""
+	}
+	return a.positional[i]
+}
+
+// Args returns all the positional arguments.
+func (a *Args) Args() []string {
+	return append([]string(nil), a.positional...)
+}
+
+// Rest returns the positional arguments joined by a single space.
+func (a *Args) Rest() string {
+	return strings.Join(a.positional, " ")
+}
+
+// Shift returns the first positional argument, typically a subcommand, and
+// the remaining arguments. Flags are retained in the returned Args.
+func (a *Args) Shift() (string, *Args) {
+	if len(a.positional) == 0 {
+		return "", a
+	}
+	return a.positional[0], &Args{positional: a.positional[1:], flags: a.flags}
+}
+
+// Has returns true if the flag was specified.
+func (a *Args) Has(name string) bool {
+	_, ok := a.flags[name]
+	return ok
+}
+
+// String returns the value of a flag, or def if the flag was not specified.
+// If the flag was specified more than once, the last value is returned.
+func (a *Args) String(name, def string) string {
+	v := a.flags[name]
+	if len(v) == 0 {
+		return def
+	}
+	return v[len(v)-1]
+}
+
+// Strings returns all the values of a flag that was specified multiple times.
+func (a *Args) Strings(name string) []string {
+	return append([]string(nil), a.flags[name]...)
+}
+
+// Bool returns the value of a boolean flag. A flag without value is true.
+func (a *Args) Bool(name string) (bool, error) {
+	if !a.Has(name) {
+		return false, nil
+	}
+	v := a.String(name, "")
+	if v == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, Usagef("invalid value %q for flag --%s: expected a boolean", v, name)
+	}
+	return b, nil
+}
+
+// Int returns the value of an integer flag, or def if not specified.
+func (a *Args) Int(name string, def int) (int, error) {
+	if !a.Has(name) {
+		return def, nil
+	}
+	v := a.String(name, "")
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, Usagef("invalid value %q for flag --%s: expected an integer", v, name)
+	}
+	return n, nil
+}
+
+// Duration returns the value of a duration flag (e.g. "1h30m"), or def if
+// not specified.
+func (a *Args) Duration(name string, def time.Duration) (time.Duration, error) {
+	if !a.Has(name) {
+		return def, nil
+	}
+	v := a.String(name, "")
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, Usagef("invalid value %q for flag --%s: expected a duration", v, name)
+	}
+	return d, nil
+}
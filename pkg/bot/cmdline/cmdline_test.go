@@ -0,0 +1,101 @@
+package cmdline
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  \t\n ", nil},
+		{"a b\tc\nd", []string{"a", "b", "c", "d"}},
+		{`"a b" c`, []string{"a b", "c"}},
+		{`'a "b"' c`, []string{`a "b"`, "c"}},
+		{`"a \"b\"" c`, []string{`a "b"`, "c"}},
+		{`a\ b c`, []string{"a b", "c"}},
+		{`--name="a b" c`, []string{"--name=a b", "c"}},
+		{`--name='a b'`, []string{"--name=a b"}},
+		{`""`, []string{""}},
+		// apostrophes in plain text are literal.
+		{"it's", []string{"it's"}},
+		{"don't won't", []string{"don't", "won't"}},
+		{`say "it's fine"`, []string{"say", "it's fine"}},
+		// trailing backslashes are literal.
+		{`a\`, []string{`a\`}},
+	} {
+		got, err := Split(tc.line)
+		if err != nil {
+			t.Errorf("Split(%q): unexpected error: %v", tc.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Split(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestSplitUnterminatedQuote(t *testing.T) {
+	for _, line := range []string{`'oops`, `a "b c`, `"a" 'b`, `--name="x y`} {
+		if got, err := Split(line); !errors.Is(err, ErrUsage) {
+			t.Errorf("Split(%q) = %q, %v, want a usage error", line, got, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	a, err := ParseLine(`sre --since 1h --all --name=x "two words" -- --literal`, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := a.Args(), []string{"sre", "two words", "--literal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %q, want %q", got, want)
+	}
+	if got := a.String("name", ""); got != "x" {
+		t.Errorf(`String("name") = %q, want "x"`, got)
+	}
+	if d, err := a.Duration("since", 0); err != nil || d != time.Hour {
+		t.Errorf(`Duration("since") = %v, %v, want 1h`, d, err)
+	}
+	if b, err := a.Bool("all"); err != nil || !b {
+		t.Errorf(`Bool("all") = %v, %v, want true`, b, err)
+	}
+	if a.Has("missing") {
+		t.Errorf(`Has("missing") = true`)
+	}
+	sub, rest := a.Shift()
+	if sub != "sre" || rest.Rest() != "two words --literal" || !rest.Has("all") {
+		t.Errorf("Shift() = %q, %q", sub, rest.Rest())
+	}
+}
+
+func TestParseTrailingFlag(t *testing.T) {
+	a := Parse([]string{"--verbose", "--count", "3", "--last"})
+	if b, err := a.Bool("verbose"); err != nil || !b {
+		t.Errorf(`Bool("verbose") = %v, %v, want true`, b, err)
+	}
+	if n, err := a.Int("count", 0); err != nil || n != 3 {
+		t.Errorf(`Int("count") = %v, %v, want 3`, n, err)
+	}
+	if b, err := a.Bool("last"); err != nil || !b {
+		t.Errorf(`Bool("last") = %v, %v, want true`, b, err)
+	}
+}
+
+func TestInvalidValues(t *testing.T) {
+	a := Parse([]string{"--n=x", "--d=soon", "--b=maybe"})
+	if _, err := a.Int("n", 0); !errors.Is(err, ErrUsage) {
+		t.Errorf(`Int("n") error = %v, want ErrUsage`, err)
+	}
+	if _, err := a.Duration("d", 0); !errors.Is(err, ErrUsage) {
+		t.Errorf(`Duration("d") error = %v, want ErrUsage`, err)
+	}
+	if _, err := a.Bool("b"); !errors.Is(err, ErrUsage) {
+		t.Errorf(`Bool("b") error = %v, want ErrUsage`, err)
+	}
+}
@@ -3,11 +3,16 @@ package bot
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"reflect"
+	"time"
 
+	"github.com/insomniacslk/slackbot/pkg/acl"
 	"github.com/insomniacslk/slackbot/pkg/credentials"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/insomniacslk/slackbot/pkg/outbound"
 	"github.com/insomniacslk/slackbot/plugins"
 	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
 )
 
 // DefaultCmdPrefix is used when no command prefix is specified in the config
@@ -16,54 +21,251 @@ var DefaultCmdPrefix = "!"
 
 // Config is a configuration object for the bot.
 type Config struct {
-	BotName     string `mapstructure:"bot_name"`
-	LogFile     string `mapstructure:"logfile"`
-	Debug       bool   `mapstructure:"debug"`
-	Credentials struct {
-		PagerDutyAPIKey    string `mapstructure:"pagerduty_api_key"`
-		SlackBotToken      string `mapstructure:"slack_bot_token"`
-		SlackAppLevelToken string `mapstructure:"slack_app_level_token"`
-	} `mapstructure:"credentials"`
-	CmdPrefix     string                 `mapstructure:"cmdprefix,omitempty"`
+	BotName string `mapstructure:"bot_name"`
+	// LogFile is the path of the log file. It is used if Log.File is not set.
+	LogFile string `mapstructure:"logfile"`
+	// Debug enables the Slack client debug output, and debug logs if
+	// Log.Level is not set.
+	Debug bool `mapstructure:"debug"`
+	// Log is the logging configuration.
+	Log         logging.Config          `mapstructure:"log"`
+	Credentials credentials.Credentials `mapstructure:"credentials"`
+	// StoragePath is the path of the SQLite database where the bot and the
+	// plugins persist their state. If empty, the state is kept in memory,
+	// including the state of the modal views opened by the plugins, which
+	// cannot be submitted after a restart.
+	StoragePath string `mapstructure:"storage_path,omitempty"`
+	// SlackAPIURL overrides the Slack web API endpoint, e.g. to point the bot
+	// to a fakeslack server in tests. Empty means the real Slack API.
+	SlackAPIURL string `mapstructure:"slack_api_url,omitempty"`
+	CmdPrefix   string `mapstructure:"cmdprefix,omitempty"`
+	// Workers is the number of commands that can run concurrently.
+	Workers int `mapstructure:"workers,omitempty"`
+	// CommandTimeout is the maximum time a command can run before it is
+	// cancelled, e.g. "30s".
+	CommandTimeout time.Duration `mapstructure:"command_timeout,omitempty"`
+	// ShowErrors controls whether the error messages of failed commands are
+	// shown to users. If false, only an error ID is shown, which can be
+	// searched for in the logs.
+	ShowErrors bool `mapstructure:"show_errors,omitempty"`
+	// ShutdownTimeout is how long to wait for running commands to complete
+	// when the bot is stopped.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout,omitempty"`
+	// DisableDirectMessages disables the commands sent in direct messages
+	// without the command prefix. Prefixed commands are still handled.
+	DisableDirectMessages bool `mapstructure:"disable_direct_messages,omitempty"`
+	// IgnoreBots are the IDs of the bots, or of their users, whose messages
+	// are ignored, e.g. to prevent loops with other bots. The messages of
+	// this bot are always ignored.
+	IgnoreBots []string `mapstructure:"ignore_bots,omitempty"`
+	// Dedupe configures the deduplication of the events redelivered by
+	// Slack.
+	Dedupe DedupeConfig `mapstructure:"dedupe,omitempty"`
+	// Edits configures the re-run of the commands whose message is edited.
+	Edits EditsConfig `mapstructure:"edits,omitempty"`
+	// AdminChannel is an optional channel ID where the bot reports
+	// administrative problems, e.g. failed configuration reloads.
+	AdminChannel string `mapstructure:"admin_channel,omitempty"`
+	// Access configures who can run which commands.
+	Access acl.Config `mapstructure:"access,omitempty"`
+	// SlashCommands maps Slack slash commands, e.g. "/oncall", to plugin
+	// commands.
+	SlashCommands map[string]SlashCommand `mapstructure:"slash_commands,omitempty"`
+	// Outbound configures the delivery of the messages posted by the bot.
+	Outbound outbound.Config `mapstructure:"outbound,omitempty"`
+	// HTTPAddr is an optional address, e.g. ":8080", where the bot serves
+	// its metrics in the Prometheus text format on /metrics, its liveness
+	// on /healthz and its readiness on /readyz.
+	HTTPAddr      string                 `mapstructure:"http_addr,omitempty"`
 	PluginConfigs map[string]interface{} `mapstructure:"plugins"`
 
-	Plugins []plugins.Plugin `mapstructure:"-"`
+	Plugins []*plugins.Instance `mapstructure:"-"`
 }
 
+// Validate validates the configuration and loads the configured plugins.
 func (c *Config) Validate() error {
-	// expand logfile
-	lf, err := homedir.Expand(c.LogFile)
-	if err != nil {
-		return fmt.Errorf("failed to expand log_file path: %w", err)
+	return c.validate(nil)
+}
+
+// validate validates the configuration and loads the configured plugins. If
+// prev is not nil, the plugins whose configuration and services did not
+// change are reused from prev instead of being loaded again.
+func (c *Config) validate(prev *Config) error {
+	if err := c.validateLog(); err != nil {
+		return err
+	}
+	if err := c.Credentials.Resolve(); err != nil {
+		return err
+	}
+	if err := c.Access.Validate(); err != nil {
+		return fmt.Errorf("invalid access configuration: %w", err)
+	}
+	if err := c.Outbound.Validate(); err != nil {
+		return fmt.Errorf("invalid outbound configuration: %w", err)
+	}
+	if err := c.Dedupe.Validate(); err != nil {
+		return fmt.Errorf("invalid dedupe configuration: %w", err)
+	}
+	if err := c.Edits.Validate(); err != nil {
+		return fmt.Errorf("invalid edits configuration: %w", err)
 	}
-	c.LogFile = lf
 
 	// if no command prefix is specified, use the default
 	if c.CmdPrefix == "" {
 		c.CmdPrefix = DefaultCmdPrefix
 	}
-	// propagate the API keys to the credentials package, so other plugins can
-	// use them.
-	credentials.SlackBotToken = c.Credentials.SlackBotToken
-	credentials.SlackAppLevelToken = c.Credentials.SlackAppLevelToken
-	credentials.PagerDutyAPIKey = c.Credentials.PagerDutyAPIKey
+	if err := c.validateSlashCommands(); err != nil {
+		return err
+	}
+	if c.Workers < 0 {
+		return fmt.Errorf("workers cannot be negative")
+	}
+	if c.Workers == 0 {
+		c.Workers = DefaultWorkers
+	}
+	if c.CommandTimeout < 0 {
+		return fmt.Errorf("command_timeout cannot be negative")
+	}
+	if c.CommandTimeout == 0 {
+		c.CommandTimeout = DefaultCommandTimeout
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown_timeout cannot be negative")
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	sp, err := homedir.Expand(c.StoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to expand storage_path: %w", err)
+	}
+	c.StoragePath = sp
 
 	// now parse each plugin
+	c.Plugins = nil
+	// the plugins are only loaded here, they are started by the bot.
+	fail := func(err error) error {
+		c.Plugins = nil
+		return err
+	}
 	for name, pconf := range c.PluginConfigs {
-		plugin := plugins.Get(name)
+		// the services of a reused instance cannot be replaced, so it is
+		// loaded again if they would change, e.g. the command prefix. The
+		// other settings passed to Services require a restart.
+		if prev != nil && prev.CmdPrefix == c.CmdPrefix {
+			if plugin := prev.plugin(name); plugin != nil && reflect.DeepEqual(prev.PluginConfigs[name], pconf) {
+				c.Plugins = append(c.Plugins, plugin)
+				continue
+			}
+		}
+		typ, _ := plugins.ParseInstanceName(name)
+		plugin := plugins.New(typ)
 		if plugin == nil {
-			return fmt.Errorf("unknown plugin %s (did you register it first?)", name)
+			return fail(fmt.Errorf("unknown plugin %s (did you register it first?)", typ))
+		}
+		pconf, commands, err := splitCommands(pconf)
+		if err != nil {
+			return fail(fmt.Errorf("invalid config for plugin %s: %w", name, err))
+		}
+		inst, err := plugins.NewInstance(name, plugin, commands)
+		if err != nil {
+			return fail(fmt.Errorf("invalid commands for plugin %s: %w", name, err))
 		}
 		// FIXME I don't like this unmarshal/marshal game
 		pconfBytes, err := json.Marshal(pconf)
 		if err != nil {
-			return fmt.Errorf("error marshalling config for plugin %s: %v", name, err)
+			return fail(fmt.Errorf("error marshalling config for plugin %s: %v", name, err))
 		}
 		if err := plugin.Load(pconfBytes); err != nil {
-			return fmt.Errorf("failed to load plugin: %w", err)
+			return fail(fmt.Errorf("failed to load plugin %s: %w", name, err))
+		}
+		c.Plugins = append(c.Plugins, inst)
+		logrus.WithField("plugin", name).Infof("Loaded plugin: %+v", pconf)
+	}
+	if err := checkCommandConflicts(c.Plugins); err != nil {
+		return fail(err)
+	}
+	if err := checkSlashCommands(c.SlashCommands, c.Plugins); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// validateLog validates the logging configuration, merging the top-level
+// logfile and debug settings into it.
+func (c *Config) validateLog() error {
+	if c.Log.File == "" {
+		c.Log.File = c.LogFile
+	}
+	if c.Log.Level == "" && c.Debug {
+		c.Log.Level = logrus.DebugLevel.String()
+	}
+	return c.Log.Validate()
+}
+
+// splitCommands removes the `commands` key, which is handled by the bot,
+// from a plugin configuration section, and returns its value.
+func splitCommands(pconf interface{}) (interface{}, []string, error) {
+	m, ok := pconf.(map[string]interface{})
+	if !ok {
+		return pconf, nil, nil
+	}
+	v, ok := m["commands"]
+	if !ok {
+		return pconf, nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("`commands` must be a list of strings")
+	}
+	commands := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("`commands` must be a list of strings")
+		}
+		commands = append(commands, s)
+	}
+	rest := make(map[string]interface{}, len(m)-1)
+	for k, v := range m {
+		if k != "commands" {
+			rest[k] = v
+		}
+	}
+	return rest, commands, nil
+}
+
+// checkCommandConflicts returns an error if the same documented command is
+// bound to more than one plugin instance.
+func checkCommandConflicts(instances []*plugins.Instance) error {
+	owner := make(map[string]string)
+	for _, inst := range instances {
+		for _, ci := range inst.Commands() {
+			for _, name := range append([]string{ci.Name}, ci.Aliases...) {
+				if other, ok := owner[name]; ok {
+					return fmt.Errorf("command %q is handled by both %s and %s, bind them to different commands", name, other, inst.Name())
+				}
+				owner[name] = inst.Name()
+			}
+		}
+	}
+	return nil
+}
+
+// shutdownTimeout returns ShutdownTimeout, or the default if not set.
+func (c *Config) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout <= 0 {
+		return DefaultShutdownTimeout
+	}
+	return c.ShutdownTimeout
+}
+
+// plugin returns the loaded plugin instance with the given name, or nil.
+func (c *Config) plugin(name string) *plugins.Instance {
+	for _, p := range c.Plugins {
+		if p.Name() == name {
+			return p
 		}
-		c.Plugins = append(c.Plugins, plugin)
-		log.Printf("Loaded plugin %s: %+v", name, pconf)
 	}
 	return nil
 }
@@ -0,0 +1,32 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+func TestCommandConflicts(t *testing.T) {
+	instance := func(key string, commands ...string) *plugins.Instance {
+		inst, err := plugins.NewInstance(key, newPagePlugin(), commands)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return inst
+	}
+
+	// two instances bound to the plugin's own commands.
+	err := checkCommandConflicts([]*plugins.Instance{instance("page/a"), instance("page/b")})
+	if err == nil || !strings.Contains(err.Error(), `"page"`) {
+		t.Errorf("got %v, want a conflict on page", err)
+	}
+	// an alias of one instance bound as the command of another.
+	err = checkCommandConflicts([]*plugins.Instance{instance("page/a"), instance("page/b", "p")})
+	if err == nil || !strings.Contains(err.Error(), `"p"`) {
+		t.Errorf("got %v, want a conflict on p", err)
+	}
+	if err := checkCommandConflicts([]*plugins.Instance{instance("page/a", "page-a"), instance("page/b", "page-b")}); err != nil {
+		t.Errorf("instances bound to different commands: %v", err)
+	}
+}
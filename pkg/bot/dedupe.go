@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// DefaultDedupeWindow is how long the handled events are remembered if
+// Config.Dedupe.Window is not set.
+var DefaultDedupeWindow = 10 * time.Minute
+
+// dedupePrefix is the storage key prefix of the handled events.
+const dedupePrefix = "events/seen/"
+
+// DedupeConfig configures the deduplication of the events redelivered by
+// Slack, e.g. after a reconnection or when an acknowledgement was lost.
+type DedupeConfig struct {
+	// Window is how long the handled events are remembered, e.g. "10m".
+	Window time.Duration `mapstructure:"window,omitempty"`
+	// Persist keeps the handled events in the bot storage, so that the
+	// events redelivered after a restart are not handled again.
+	Persist bool `mapstructure:"persist,omitempty"`
+}
+
+// Validate checks the configuration and sets the defaults.
+func (c *DedupeConfig) Validate() error {
+	if c.Window < 0 {
+		return fmt.Errorf("window cannot be negative")
+	}
+	if c.Window == 0 {
+		c.Window = DefaultDedupeWindow
+	}
+	return nil
+}
+
+// deduper remembers the keys of the handled events for a time window. The
+// keys are also saved in store, if not nil.
+type deduper struct {
+	window time.Duration
+	store  storage.Store
+	log    *logrus.Entry
+
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastPrune time.Time
+}
+
+// newDeduper returns a deduper, loading the keys saved in store if not nil.
+func newDeduper(ctx context.Context, cfg DedupeConfig, store storage.Store, log *logrus.Entry) *deduper {
+	// errors are reported by Config.Validate, this sets the defaults.
+	_ = cfg.Validate()
+	d := deduper{
+		window:    cfg.Window,
+		log:       log,
+		expires:   make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+	if cfg.Persist {
+		d.store = store
+		d.load(ctx)
+	}
+	return &d
+}
+
+// load loads the unexpired keys from the storage, and deletes the others.
+func (d *deduper) load(ctx context.Context) {
+	keys, err := d.store.List(ctx, dedupePrefix)
+	if err != nil {
+		d.log.Warnf("Failed to list the handled events: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, key := range keys {
+		data, err := d.store.Get(ctx, key)
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				d.log.Warnf("Failed to load handled event %s: %v", key, err)
+			}
+			continue
+		}
+		expires, err := time.Parse(time.RFC3339Nano, string(data))
+		if err != nil || now.After(expires) {
+			d.delete(ctx, key)
+			continue
+		}
+		d.expires[strings.TrimPrefix(key, dedupePrefix)] = expires
+	}
+}
+
+// seen records keys as handled, and returns true if any of them was handled
+// already within the window. Empty keys are ignored.
+func (d *deduper) seen(ctx context.Context, keys ...string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.Sub(d.lastPrune) > d.window {
+		d.prune(ctx, now)
+	}
+	for _, key := range keys {
+		if expires, ok := d.expires[key]; ok && now.Before(expires) {
+			return true
+		}
+	}
+	expires := now.Add(d.window)
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		d.expires[key] = expires
+		if d.store != nil {
+			if err := d.store.Put(ctx, dedupePrefix+key, []byte(expires.Format(time.RFC3339Nano))); err != nil {
+				d.log.Warnf("Failed to save handled event %s: %v", key, err)
+			}
+		}
+	}
+	return false
+}
+
+// prune forgets the expired keys. It must be called with d.mu held.
+func (d *deduper) prune(ctx context.Context, now time.Time) {
+	for key, expires := range d.expires {
+		if now.After(expires) {
+			delete(d.expires, key)
+			if d.store != nil {
+				d.delete(ctx, dedupePrefix+key)
+			}
+		}
+	}
+	d.lastPrune = now
+}
+
+func (d *deduper) delete(ctx context.Context, key string) {
+	if err := d.store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		d.log.Warnf("Failed to delete handled event %s: %v", key, err)
+	}
+}
+
+// eventKeys returns the deduplication keys of an Events API event: its event
+// ID and, for messages, the message timestamp, since the same message can be
+// delivered again with a different event ID.
+func eventKeys(ev *slackevents.EventsAPIEvent) []string {
+	var keys []string
+	if cb, ok := ev.Data.(*slackevents.EventsAPICallbackEvent); ok && cb.EventID != "" {
+		keys = append(keys, "event/"+cb.EventID)
+	}
+	switch iev := ev.InnerEvent.Data.(type) {
+	case *slackevents.MessageEvent:
+		if iev.SubType == "" {
+			keys = append(keys, "message/"+iev.Channel+"/"+iev.TimeStamp)
+		}
+	case *slackevents.AppMentionEvent:
+		keys = append(keys, "app_mention/"+iev.Channel+"/"+iev.TimeStamp)
+	}
+	return keys
+}
+
+// Reasons to ignore events, used as label values of
+// slackbot_events_ignored_total.
+const (
+	ignoreSelf      = "self"
+	ignoreBot       = "bot"
+	ignoreSubtype   = "subtype"
+	ignoreDuplicate = "duplicate"
+)
+
+// messageSubtypes are the message subtypes handled like plain messages. The
+// others, e.g. message_deleted or channel_join, are ignored.
+var messageSubtypes = map[string]bool{
+	"":                 true,
+	"bot_message":      true,
+	"file_share":       true,
+	"me_message":       true,
+	"thread_broadcast": true,
+}
+
+// ignoreMessage returns the reason to ignore a message sent by user or bot
+// with the given subtype, or empty if it must be handled. The messages of
+// the bot itself are always ignored, so that its replies do not trigger it
+// again.
+func (b *Bot) ignoreMessage(user, botID, subtype string) string {
+	switch {
+	case (b.selfID != "" && user == b.selfID) || (b.selfBotID != "" && botID == b.selfBotID):
+		return ignoreSelf
+	case botID != "" && (contains(b.Config().IgnoreBots, botID) || contains(b.Config().IgnoreBots, user)):
+		return ignoreBot
+	case !messageSubtypes[subtype]:
+		return ignoreSubtype
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDeduperSeen(t *testing.T) {
+	ctx := context.Background()
+	d := newDeduper(ctx, DedupeConfig{}, nil, logrus.NewEntry(logrus.New()))
+	if d.window != DefaultDedupeWindow {
+		t.Errorf("got window %v, want the default %v", d.window, DefaultDedupeWindow)
+	}
+	if d.seen(ctx, "event/Ev1", "message/C1/1.1") {
+		t.Errorf("first event reported as seen")
+	}
+	if !d.seen(ctx, "event/Ev1") {
+		t.Errorf("same event ID not reported as seen")
+	}
+	if !d.seen(ctx, "event/Ev2", "message/C1/1.1") {
+		t.Errorf("same message with another event ID not reported as seen")
+	}
+	if d.seen(ctx, "event/Ev3", "") || d.seen(ctx, "event/Ev4", "") {
+		t.Errorf("empty keys must be ignored")
+	}
+}
+
+func TestDeduperExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	d := newDeduper(ctx, DedupeConfig{Window: 20 * time.Millisecond, Persist: true}, store, logrus.NewEntry(logrus.New()))
+	d.seen(ctx, "event/Ev1")
+	time.Sleep(50 * time.Millisecond)
+	if d.seen(ctx, "event/Ev1") {
+		t.Errorf("expired event reported as seen")
+	}
+	// the expired key was pruned, and saved again.
+	if len(d.expires) != 1 {
+		t.Errorf("got %d keys, want 1", len(d.expires))
+	}
+}
+
+func TestDeduperPersist(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	log := logrus.NewEntry(logrus.New())
+	d := newDeduper(ctx, DedupeConfig{Persist: true}, store, log)
+	d.seen(ctx, "event/Ev1")
+
+	// a restarted bot loads the handled events.
+	d = newDeduper(ctx, DedupeConfig{Persist: true}, store, log)
+	if !d.seen(ctx, "event/Ev1") {
+		t.Errorf("event handled before the restart not reported as seen")
+	}
+
+	// expired events are deleted from the storage on load.
+	if err := store.Put(ctx, dedupePrefix+"event/old", []byte(time.Now().Add(-time.Minute).Format(time.RFC3339Nano))); err != nil {
+		t.Fatal(err)
+	}
+	d = newDeduper(ctx, DedupeConfig{Persist: true}, store, log)
+	if _, ok := d.expires["event/old"]; ok {
+		t.Errorf("expired event loaded")
+	}
+	if _, err := store.Get(ctx, dedupePrefix+"event/old"); err != storage.ErrNotFound {
+		t.Errorf("expired event not deleted: %v", err)
+	}
+
+	// without Persist nothing is saved.
+	d = newDeduper(ctx, DedupeConfig{}, store, log)
+	d.seen(ctx, "event/Ev5")
+	if _, err := store.Get(ctx, dedupePrefix+"event/Ev5"); err != storage.ErrNotFound {
+		t.Errorf("event saved without Persist: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// parseDirectMessage returns the command sent to the bot in a direct message
+// conversation, with or without the command prefix. A leading mention of the
+// bot is ignored. The replies stay in the conversation.
+func (b *Bot) parseDirectMessage(ev *slackevents.MessageEvent) (chat.Command, bool) {
+	text := ev.Text
+	if t, ok := b.stripMention(text); ok {
+		text = t
+	}
+	name, arg := splitCmd(text)
+	if b.isCmd(name) {
+		name = name[len(b.Config().CmdPrefix):]
+	}
+	if name == "" {
+		return chat.Command{}, false
+	}
+	return chat.Command{
+		Name:        name,
+		Arg:         arg,
+		Message:     messageFromEvent(ev),
+		ChannelType: chat.ChannelDirect,
+	}, true
+}
+
+// channelTypeFromID guesses the type of a channel from its ID, for the events
+// that do not report it. It returns empty if unknown: public and private
+// channels cannot be told apart by their ID.
+func channelTypeFromID(id string) string {
+	switch {
+	case strings.HasPrefix(id, "D"):
+		return chat.ChannelDirect
+	case strings.HasPrefix(id, "G"):
+		// legacy private channels, or group direct messages.
+		return chat.ChannelPrivate
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// DefaultWorkers is the default number of workers that handle commands.
+var DefaultWorkers = 8
+
+// DefaultQueueSize is the default number of commands that can be queued for
+// each worker before new commands are rejected.
+var DefaultQueueSize = 32
+
+// DefaultCommandTimeout is the default maximum duration of a command.
+var DefaultCommandTimeout = 30 * time.Second
+
+// DefaultShutdownTimeout is the default time to wait for running commands
+// to complete on shutdown.
+var DefaultShutdownTimeout = 30 * time.Second
+
+type job struct {
+	run func(ctx context.Context)
+	// onTimeout is called as soon as the job's context times out, while
+	// run may still be running.
+	onTimeout func()
+	// timeout overrides the dispatcher's timeout if greater than zero.
+	timeout time.Duration
+}
+
+// dispatcher runs jobs on a bounded pool of workers. Jobs with the same key
+// always run on the same worker, so their ordering is preserved.
+type dispatcher struct {
+	queues  []chan job
+	timeout time.Duration
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+}
+
+func newDispatcher(workers, queueSize int, timeout time.Duration) *dispatcher {
+	d := dispatcher{
+		queues:  make([]chan job, workers),
+		timeout: timeout,
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan job, queueSize)
+	}
+	return &d
+}
+
+// start starts the workers. Jobs' contexts are derived from ctx.
+func (d *dispatcher) start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	for _, q := range d.queues {
+		d.wg.Add(1)
+		go d.worker(ctx, q)
+	}
+}
+
+// dispatch enqueues a job. It returns false if the worker's queue is full.
+func (d *dispatcher) dispatch(key string, j job) bool {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	select {
+	case d.queues[h.Sum32()%uint32(len(d.queues))] <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop waits for all the queued jobs to complete. If ctx is done first, the
+// running jobs are cancelled and the queued ones are discarded. No job can be
+// dispatched after calling stop.
+func (d *dispatcher) stop(ctx context.Context) error {
+	for _, q := range d.queues {
+		close(q)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return ctx.Err()
+	}
+}
+
+func (d *dispatcher) worker(ctx context.Context, queue chan job) {
+	defer d.wg.Done()
+	for j := range queue {
+		if ctx.Err() != nil {
+			// stopped, discard the remaining jobs
+			continue
+		}
+		d.runJob(ctx, j)
+	}
+}
+
+func (d *dispatcher) runJob(ctx context.Context, j job) {
+	timeout := d.timeout
+	if j.timeout > 0 {
+		timeout = j.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.run(ctx)
+	}()
+	select {
+	case <-done:
+		if ctx.Err() == context.DeadlineExceeded && j.onTimeout != nil {
+			j.onTimeout()
+		}
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded && j.onTimeout != nil {
+			j.onTimeout()
+		}
+		// wait for the job to return even if it ignores the context, so
+		// that the next job with the same key does not overtake it.
+		<-done
+	}
+}
@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+)
+
+func TestCommandKey(t *testing.T) {
+	top := chat.Command{Message: chat.Message{Channel: "C1", Timestamp: "1.1"}}
+	other := chat.Command{Message: chat.Message{Channel: "C1", Timestamp: "2.2"}}
+	reply := chat.Command{Message: chat.Message{Channel: "C1", Timestamp: "3.3", ThreadTimestamp: "1.1"}}
+	slash1 := chat.Command{Slash: "/oncall", TriggerID: "t1", Message: chat.Message{Channel: "C1"}}
+	slash2 := chat.Command{Slash: "/oncall", TriggerID: "t2", Message: chat.Message{Channel: "C1"}}
+
+	if commandKey(&top) == commandKey(&other) {
+		t.Errorf("top-level commands in the same channel share the key %q", commandKey(&top))
+	}
+	if commandKey(&top) != commandKey(&reply) {
+		t.Errorf("a command and the replies in its thread have different keys: %q, %q", commandKey(&top), commandKey(&reply))
+	}
+	if commandKey(&slash1) == commandKey(&slash2) || commandKey(&slash1) == commandKey(&top) {
+		t.Errorf("slash commands do not have their own keys: %q, %q", commandKey(&slash1), commandKey(&slash2))
+	}
+}
+
+func TestDispatcherOrder(t *testing.T) {
+	d := newDispatcher(4, 100, time.Second)
+	d.start(context.Background())
+	var (
+		mu  sync.Mutex
+		got []int
+	)
+	for i := 0; i < 100; i++ {
+		i := i
+		if !d.dispatch("C1/1.1", job{run: func(ctx context.Context) {
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+		}}) {
+			t.Fatalf("job %d rejected", i)
+		}
+	}
+	if err := d.stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range got {
+		if n != i {
+			t.Fatalf("jobs with the same key ran out of order: %v", got)
+		}
+	}
+	if len(got) != 100 {
+		t.Errorf("got %d jobs, want 100", len(got))
+	}
+}
+
+// blockingJobs returns a job that blocks until release is closed, and
+// functions returning the number of jobs running now and at most.
+func blockingJobs(release <-chan struct{}) (job, func() int32, func() int32) {
+	var running, maxRunning int32
+	j := job{run: func(ctx context.Context) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+	}}
+	return j, func() int32 { return atomic.LoadInt32(&running) }, func() int32 { return atomic.LoadInt32(&maxRunning) }
+}
+
+// waitFor waits until cond is true.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherWorkers(t *testing.T) {
+	const workers = 2
+	d := newDispatcher(workers, 100, time.Second)
+	d.start(context.Background())
+	release := make(chan struct{})
+	blocking, running, maxRunning := blockingJobs(release)
+	for i := 0; i < 10; i++ {
+		if !d.dispatch(fmt.Sprintf("key%d", i), blocking) {
+			t.Fatalf("job %d rejected", i)
+		}
+	}
+	waitFor(t, func() bool { return running() == workers })
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := d.stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if m := maxRunning(); m != workers {
+		t.Errorf("got %d jobs running concurrently, want %d", m, workers)
+	}
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	d := newDispatcher(1, 1, time.Second)
+	d.start(context.Background())
+	release := make(chan struct{})
+	blocking, running, _ := blockingJobs(release)
+	if !d.dispatch("a", blocking) {
+		t.Fatal("first job rejected")
+	}
+	waitFor(t, func() bool { return running() == 1 })
+	if !d.dispatch("b", blocking) {
+		t.Fatal("queued job rejected")
+	}
+	if d.dispatch("c", blocking) {
+		t.Errorf("job accepted with a full queue")
+	}
+	close(release)
+	if err := d.stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcherTimeout(t *testing.T) {
+	d := newDispatcher(1, 10, time.Hour)
+	d.start(context.Background())
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(ev string) {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	}
+	// the job ignores its context: the next job waits for it anyway.
+	d.dispatch("k", job{
+		run: func(ctx context.Context) {
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			record("first done")
+		},
+		onTimeout: func() { record("first timed out") },
+		timeout:   10 * time.Millisecond,
+	})
+	d.dispatch("k", job{
+		run:       func(ctx context.Context) { record("second done") },
+		onTimeout: func() { record("second timed out") },
+	})
+	if err := d.stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first timed out", "first done", "second done"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %q, want %q", events, want)
+	}
+}
+
+func TestCommandTimeoutReply(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	slow := &testPlugin{name: "slow", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	startBot(t, srv, &Config{CommandTimeout: 50 * time.Millisecond}, slow)
+
+	send(srv.SendMessage("C1", "U1", ".slow"))
+	want := "Sorry, `.slow` took too long and was cancelled."
+	if p := expectPost(t, srv); p.Text != want {
+		t.Errorf("got %q, want %q", p.Text, want)
+	}
+	expectNoPost(t, srv)
+}
@@ -0,0 +1,269 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/actions"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/fakeslack"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// testPlugin handles the command with its name by calling handle.
+type testPlugin struct {
+	name   string
+	handle func(ctx context.Context, client chat.Client, cmd *chat.Command) error
+}
+
+func (p *testPlugin) Name() string            { return p.name }
+func (p *testPlugin) Load([]byte) error       { return nil }
+func (p *testPlugin) Handles(cmd string) bool { return cmd == p.name }
+
+func (p *testPlugin) HandleCmd(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+	return p.handle(ctx, client, cmd)
+}
+
+// echoPlugin replies "echo: <arg>" in the thread of the command.
+func echoPlugin() *testPlugin {
+	return &testPlugin{name: "echo", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		return actions.Say(ctx, client, cmd.Message.Channel, cmd.Message.ThreadTimestamp, "echo: %s", cmd.Arg)
+	}}
+}
+
+// newServer returns a fake Slack server, closed at the end of the test after
+// the bot stopped.
+func newServer(t *testing.T) *fakeslack.Server {
+	srv := fakeslack.New()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// startBot runs a bot connected to srv with the given plugins until the end
+// of the test.
+func startBot(t *testing.T, srv *fakeslack.Server, cfg *Config, ps ...plugins.Plugin) *Bot {
+	t.Helper()
+	cfg.SlackAPIURL = srv.APIURL()
+	if cfg.CmdPrefix == "" {
+		cfg.CmdPrefix = "."
+	}
+	for _, p := range ps {
+		inst, err := plugins.NewInstance(p.Name(), p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Plugins = append(cfg.Plugins, inst)
+	}
+	b := New(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Errorf("the bot did not stop")
+		}
+	})
+	if err := srv.WaitForConnection(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func expectPost(t *testing.T, srv *fakeslack.Server) fakeslack.Post {
+	t.Helper()
+	p, err := srv.WaitForPost(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func expectNoPost(t *testing.T, srv *fakeslack.Server) {
+	t.Helper()
+	if p, err := srv.WaitForPost(300 * time.Millisecond); err == nil {
+		t.Fatalf("unexpected post: %+v", p)
+	}
+}
+
+// sender returns a function that fails the test if sending an envelope
+// failed, and returns its ID otherwise.
+func sender(t *testing.T) func(id string, err error) string {
+	return func(id string, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+}
+
+// messageEvent returns a message event sent by user in a public channel.
+func messageEvent(channel, user, ts, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":         "message",
+		"channel":      channel,
+		"channel_type": "channel",
+		"user":         user,
+		"text":         text,
+		"ts":           ts,
+	}
+}
+
+func TestPrefixCommand(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{}, echoPlugin())
+
+	send(srv.SendMessage("C1", "U1", "echo not a command"))
+	id := send(srv.SendMessage("C1", "U1", ".echo hello   world"))
+	if _, err := srv.WaitForAck(id, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	p := expectPost(t, srv)
+	if p.Channel != "C1" || p.Text != "echo: hello   world" {
+		t.Errorf("got %q in %s, want %q in C1", p.Text, p.Channel, "echo: hello   world")
+	}
+	expectNoPost(t, srv)
+}
+
+func TestUnterminatedQuote(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{}, echoPlugin())
+
+	send(srv.SendMessage("C1", "U1", `.echo "hello world`))
+	want := `Invalid usage: unterminated " quote`
+	if p := expectPost(t, srv); p.Text != want {
+		t.Errorf("got %q, want %q", p.Text, want)
+	}
+	expectNoPost(t, srv)
+}
+
+func TestMention(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{}, echoPlugin())
+
+	send(srv.SendEvent(map[string]interface{}{
+		"type":      "app_mention",
+		"channel":   "C1",
+		"user":      "U1",
+		"text":      fmt.Sprintf("<@%s> echo it's me", srv.BotUserID),
+		"ts":        "2.2",
+		"thread_ts": "1.1",
+	}))
+	p := expectPost(t, srv)
+	if p.Text != "echo: it's me" || p.ThreadTS != "1.1" {
+		t.Errorf("got %q in thread %q, want %q in thread 1.1", p.Text, p.ThreadTS, "echo: it's me")
+	}
+
+	send(srv.SendEvent(map[string]interface{}{
+		"type":    "app_mention",
+		"channel": "C1",
+		"user":    "U1",
+		"text":    fmt.Sprintf("<@%s>", srv.BotUserID),
+		"ts":      "3.3",
+	}))
+	if p := expectPost(t, srv); p.Text == "" || p.ThreadTS != "" {
+		t.Errorf("got %q in thread %q, want a help summary in the channel", p.Text, p.ThreadTS)
+	}
+}
+
+func TestDirectMessage(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	var channelType string
+	echo := echoPlugin()
+	handle := echo.handle
+	echo.handle = func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		channelType = cmd.ChannelType
+		return handle(ctx, client, cmd)
+	}
+	startBot(t, srv, &Config{}, echo)
+
+	send(srv.SendDirectMessage("D1", "U1", "echo hi"))
+	p := expectPost(t, srv)
+	if p.Channel != "D1" || p.Text != "echo: hi" {
+		t.Errorf("got %q in %s, want %q in D1", p.Text, p.Channel, "echo: hi")
+	}
+	if channelType != chat.ChannelDirect {
+		t.Errorf("got channel type %q, want %q", channelType, chat.ChannelDirect)
+	}
+}
+
+func TestSlowCommandDoesNotBlockChannel(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	release := make(chan struct{})
+	defer close(release)
+	slow := &testPlugin{name: "slow", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}}
+	cfg := Config{SlashCommands: map[string]SlashCommand{"/echo": {Command: "echo"}}, CommandTimeout: time.Minute}
+	startBot(t, srv, &cfg, echoPlugin(), slow)
+
+	send(srv.SendEvent(messageEvent("C1", "U1", "1.1", ".slow")))
+	send(srv.SendEvent(messageEvent("C1", "U1", "2.2", ".echo top-level")))
+	send(srv.SendSlashCommand("/echo", "C1", "U1", "slash"))
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		got[expectPost(t, srv).Text] = true
+	}
+	if !got["echo: top-level"] || !got["echo: slash"] {
+		t.Errorf("got %v, want the replies to the commands sent after the slow one", got)
+	}
+}
+
+func TestDuplicateEnvelope(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{}, echoPlugin())
+
+	payload := map[string]interface{}{
+		"type":     "event_callback",
+		"event_id": "Ev1",
+		"event":    messageEvent("C1", "U1", "1.1", ".echo once"),
+	}
+	send(srv.SendEnvelope("events_api", payload))
+	// a redelivery, as after a reconnection.
+	send(srv.SendEnvelope("events_api", payload))
+	// the same message with another event ID.
+	payload["event_id"] = "Ev2"
+	send(srv.SendEnvelope("events_api", payload))
+	if p := expectPost(t, srv); p.Text != "echo: once" {
+		t.Errorf("got %q, want %q", p.Text, "echo: once")
+	}
+	expectNoPost(t, srv)
+}
+
+func TestSelfMessage(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{IgnoreBots: []string{"BOTHER"}}, echoPlugin())
+
+	own := messageEvent("C1", srv.BotUserID, "1.1", ".echo loop")
+	own["bot_id"] = srv.BotID
+	send(srv.SendEvent(own))
+	other := messageEvent("C1", "UOTHER", "2.2", ".echo loop")
+	other["bot_id"] = "BOTHER"
+	send(srv.SendEvent(other))
+	deleted := messageEvent("C1", "U1", "3.3", ".echo deleted")
+	deleted["subtype"] = "channel_join"
+	send(srv.SendEvent(deleted))
+	send(srv.SendEvent(messageEvent("C1", "U1", "4.4", ".echo human")))
+	if p := expectPost(t, srv); p.Text != "echo: human" {
+		t.Errorf("got %q, want %q", p.Text, "echo: human")
+	}
+	expectNoPost(t, srv)
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// PanicError is returned when a plugin panics while handling a command.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// newErrorID returns a short random identifier used to correlate the error
+// shown to users with the logs.
+func newErrorID() string {
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// invoke calls the command handler of the plugin instance, converting panics
+// into a *PanicError. The plugin receives the command name it is mapped to.
+func (b *Bot) invoke(ctx context.Context, plugin *plugins.Instance, client chat.Client, cmd *chat.Command) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	c := *cmd
+	c.Name = plugin.Command(cmd.Name)
+	return plugin.Plugin.HandleCmd(ctx, client, &c)
+}
+
+// replyError logs a command error with a new error ID, and replies in the
+// command's thread with the error ID and, if enabled in the configuration,
+// the error message.
+func (b *Bot) replyError(ctx context.Context, client chat.Client, plugin *plugins.Instance, cmd *chat.Command, err error) {
+	id := newErrorID()
+	log := logging.FromContext(ctx).WithField("error_id", id)
+	if perr, ok := err.(*PanicError); ok {
+		log.WithField("stack", string(perr.Stack)).Errorf("Plugin panicked: %v", perr.Value)
+	} else {
+		log.Errorf("Command failed: %v", err)
+	}
+	msg := fmt.Sprintf("Sorry, `%s%s` failed (error ID: `%s`).", b.Config().CmdPrefix, cmd.Name, id)
+	if b.Config().ShowErrors {
+		msg += fmt.Sprintf("\n> %v", err)
+	}
+	b.reply(ctx, client, &cmd.Message, "%s", msg)
+}
@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+var errorIDRegexp = regexp.MustCompile("error ID: `([0-9a-f]+)`")
+
+// failingPlugins returns a plugin that panics and one that fails.
+func failingPlugins() (*testPlugin, *testPlugin) {
+	return &testPlugin{name: "boom", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		panic("kaboom")
+	}}, &testPlugin{name: "fail", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		return errors.New("database down")
+	}}
+}
+
+// errorID returns the error ID shown in a reply, and the log entry with
+// the same ID.
+func errorID(t *testing.T, hook *test.Hook, reply string) (string, *logrus.Entry) {
+	t.Helper()
+	m := errorIDRegexp.FindStringSubmatch(reply)
+	if m == nil {
+		t.Fatalf("no error ID in %q", reply)
+	}
+	for _, e := range hook.AllEntries() {
+		if e.Data["error_id"] == m[1] {
+			return m[1], e
+		}
+	}
+	t.Fatalf("no log entry with error ID %s", m[1])
+	return "", nil
+}
+
+func TestCommandErrors(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	hook := test.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+	boom, fail := failingPlugins()
+	startBot(t, srv, &Config{}, boom, fail, echoPlugin())
+
+	send(srv.SendMessage("C1", "U1", ".boom"))
+	p := expectPost(t, srv)
+	if !regexp.MustCompile("^Sorry, `.boom` failed \\(error ID: `[0-9a-f]+`\\)\\.$").MatchString(p.Text) {
+		t.Errorf("got %q, want the error ID only", p.Text)
+	}
+	_, e := errorID(t, hook, p.Text)
+	if e.Message != "Plugin panicked: kaboom" || e.Data["stack"] == nil || e.Data["plugin"] != "boom" {
+		t.Errorf("got log entry %q with fields %v, want the panic and its stack", e.Message, e.Data)
+	}
+
+	send(srv.SendMessage("C1", "U1", ".fail"))
+	p = expectPost(t, srv)
+	if _, e := errorID(t, hook, p.Text); e.Message != "Command failed: database down" {
+		t.Errorf("got log entry %q, want the command error", e.Message)
+	}
+
+	// the bot survives the panic.
+	send(srv.SendMessage("C1", "U1", ".echo still here"))
+	if p := expectPost(t, srv); p.Text != "echo: still here" {
+		t.Errorf("got %q, want %q", p.Text, "echo: still here")
+	}
+}
+
+func TestShowErrors(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	hook := test.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+	boom, fail := failingPlugins()
+	startBot(t, srv, &Config{ShowErrors: true}, boom, fail)
+
+	for cmd, msg := range map[string]string{".boom": "panic: kaboom", ".fail": "database down"} {
+		send(srv.SendMessage("C1", "U1", cmd))
+		p := expectPost(t, srv)
+		id, _ := errorID(t, hook, p.Text)
+		want := "Sorry, `" + cmd + "` failed (error ID: `" + id + "`).\n> " + msg
+		if p.Text != want {
+			t.Errorf("got %q, want %q", p.Text, want)
+		}
+	}
+}
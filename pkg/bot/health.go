@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// DefaultHeartbeatInterval is how often the event loop records that it is
+// alive. The bot is unhealthy if the event loop did not run for three
+// intervals.
+var DefaultHeartbeatInterval = 10 * time.Second
+
+// healthCheckTimeout is the maximum time a plugin health check can take.
+const healthCheckTimeout = 5 * time.Second
+
+// healthCheck is the result of a single health check.
+type healthCheck struct {
+	name string
+	err  error
+}
+
+// heartbeat records that the event loop is alive.
+func (b *Bot) heartbeat() {
+	b.lastHeartbeat.Store(time.Now().UnixNano())
+}
+
+// checkHealth runs the liveness check: the event loop is not wedged. If ready
+// is true, it also runs the readiness checks: the plugins were started and
+// report no problems, and the Socket Mode connection is established. The
+// plugin checks only affect the readiness, so that a failing dependency of a
+// plugin does not get the bot restarted. Likewise, the bot is alive but not
+// ready while it starts, before the event loop runs.
+func (b *Bot) checkHealth(ctx context.Context, ready bool) []healthCheck {
+	var checks []healthCheck
+	var err error
+	if last := b.lastHeartbeat.Load(); last != 0 {
+		if since := time.Since(time.Unix(0, last)); since > 3*DefaultHeartbeatInterval {
+			err = fmt.Errorf("no activity for %s", since.Round(time.Second))
+		}
+	}
+	checks = append(checks, healthCheck{name: "event_loop", err: err})
+	if !ready {
+		return checks
+	}
+	err = nil
+	if !b.pluginsStarted.Load() {
+		err = errors.New("not started")
+	}
+	checks = append(checks, healthCheck{name: "plugins", err: err})
+	err = nil
+	if !b.connected.Load() {
+		err = errors.New("not connected")
+	}
+	checks = append(checks, healthCheck{name: "socket_mode", err: err})
+	for _, p := range b.Config().Plugins {
+		hc, ok := p.Plugin.(plugins.HealthChecker)
+		if !ok || p.Services == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		checks = append(checks, healthCheck{name: "plugin " + p.Name(), err: hc.HealthCheck(ctx)})
+		cancel()
+	}
+	return checks
+}
+
+// healthHandler returns an HTTP handler that reports the health checks, with
+// status 503 if any of them failed.
+func (b *Bot) healthHandler(ready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := b.checkHealth(r.Context(), ready)
+		status := http.StatusOK
+		lines := make([]string, 0, len(checks))
+		for _, c := range checks {
+			if c.err != nil {
+				status = http.StatusServiceUnavailable
+				lines = append(lines, fmt.Sprintf("[-] %s failed: %v", c.name, c.err))
+			} else {
+				lines = append(lines, fmt.Sprintf("[+] %s ok", c.name))
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, strings.Join(lines, "\n"))
+	}
+}
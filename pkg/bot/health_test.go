@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+)
+
+// unhealthyPlugin is a testPlugin whose health check fails.
+type unhealthyPlugin struct {
+	testPlugin
+}
+
+func (p *unhealthyPlugin) HealthCheck(ctx context.Context) error {
+	return errors.New("database unreachable")
+}
+
+func TestHealthChecks(t *testing.T) {
+	srv := newServer(t)
+	p := &unhealthyPlugin{testPlugin{name: "db", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		return nil
+	}}}
+	b := startBot(t, srv, &Config{}, p)
+
+	for _, tc := range []struct {
+		ready bool
+		want  int
+	}{
+		// a failing plugin does not make the bot unhealthy, only not ready.
+		{false, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+	} {
+		w := httptest.NewRecorder()
+		b.healthHandler(tc.ready).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != tc.want {
+			t.Errorf("ready=%v: got status %d, want %d:\n%s", tc.ready, w.Code, tc.want, w.Body)
+		}
+	}
+}
+
+func TestHealthBeforeRun(t *testing.T) {
+	// while starting, the bot is alive but not ready.
+	b := New(&Config{})
+	for _, tc := range []struct {
+		ready bool
+		want  int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+	} {
+		w := httptest.NewRecorder()
+		b.healthHandler(tc.ready).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != tc.want {
+			t.Errorf("ready=%v: got status %d, want %d:\n%s", tc.ready, w.Code, tc.want, w.Body)
+		}
+	}
+}
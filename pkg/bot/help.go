@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/insomniacslk/slackbot/pkg/bot/cmdline"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// HelpCmd is the name of the built-in help command.
+const HelpCmd = "help"
+
+// help returns the help text for all commands, or for a single command if cmd
+// is not empty.
+func (b *Bot) help(cmd string) string {
+	prefix := b.Config().CmdPrefix
+	if cmd != "" {
+		cmd = strings.TrimPrefix(cmd, prefix)
+		for _, p := range b.Config().Plugins {
+			for _, ci := range p.Commands() {
+				if !ci.Matches(cmd) {
+					continue
+				}
+				msg := fmt.Sprintf("`%s`", ci.Usage(prefix))
+				if ci.Description != "" {
+					msg += "\n" + ci.Description
+				}
+				if len(ci.Aliases) > 0 {
+					msg += fmt.Sprintf("\nAliases: %s", strings.Join(ci.Aliases, ", "))
+				}
+				return msg
+			}
+		}
+		return fmt.Sprintf("Unknown command `%s`. Try `%s%s` for a list of commands.", cmd, prefix, HelpCmd)
+	}
+
+	var (
+		lines        []string
+		undocumented []string
+	)
+	for _, p := range b.Config().Plugins {
+		cmds := p.Commands()
+		if len(cmds) == 0 {
+			undocumented = append(undocumented, p.Name())
+			continue
+		}
+		for _, ci := range cmds {
+			line := fmt.Sprintf("• `%s`", ci.Usage(prefix)) + describe(ci)
+			if p.Name() != p.Type {
+				line += fmt.Sprintf(" (%s)", p.Name())
+			}
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	lines = append(lines, fmt.Sprintf("• `%s%s [command]`: show this help, or the help of a command", prefix, HelpCmd))
+	msg := "Available commands:\n" + strings.Join(lines, "\n")
+	if len(undocumented) > 0 {
+		sort.Strings(undocumented)
+		msg += fmt.Sprintf("\nPlugins without documentation: %s", strings.Join(undocumented, ", "))
+	}
+	return msg
+}
+
+func describe(ci plugins.CommandInfo) string {
+	if ci.Description == "" {
+		return ""
+	}
+	return ": " + ci.Description
+}
+
+// replyUsage replies to a command that was invoked with invalid arguments,
+// showing the error and, if documented, the command usage.
+func (b *Bot) replyUsage(ctx context.Context, client chat.Client, plugin *plugins.Instance, cmd *chat.Command, err error) {
+	msg := "Invalid usage"
+	var uerr *cmdline.UsageError
+	if errors.As(err, &uerr) {
+		msg += ": " + uerr.Msg
+	}
+	for _, ci := range plugin.Commands() {
+		if ci.Matches(cmd.Name) {
+			msg += fmt.Sprintf("\nUsage: `%s`", ci.Usage(b.Config().CmdPrefix))
+			break
+		}
+	}
+	b.reply(ctx, client, &cmd.Message, "%s", msg)
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/bot/cmdline"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// pagePlugin is a documented plugin whose command requires an argument.
+type pagePlugin struct {
+	testPlugin
+}
+
+func newPagePlugin() *pagePlugin {
+	return &pagePlugin{testPlugin{name: "page", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		if cmd.Args.NArg() == 0 {
+			return cmdline.Usagef("missing user")
+		}
+		return nil
+	}}}
+}
+
+func (p *pagePlugin) Handles(cmd string) bool { return cmd == "page" || cmd == "p" }
+
+func (p *pagePlugin) Commands() []plugins.CommandInfo {
+	return []plugins.CommandInfo{{Name: "page", Aliases: []string{"p"}, Syntax: "<user>", Description: "pages a user"}}
+}
+
+func TestHelp(t *testing.T) {
+	var insts []*plugins.Instance
+	for _, tc := range []struct {
+		key      string
+		plugin   plugins.Plugin
+		commands []string
+	}{
+		{"page", newPagePlugin(), nil},
+		{"page/sre", newPagePlugin(), []string{"page-sre"}},
+		{"echo", echoPlugin(), nil},
+	} {
+		inst, err := plugins.NewInstance(tc.key, tc.plugin, tc.commands)
+		if err != nil {
+			t.Fatal(err)
+		}
+		insts = append(insts, inst)
+	}
+	b := New(&Config{CmdPrefix: ".", Plugins: insts})
+
+	for _, tc := range []struct {
+		cmd  string
+		want string
+	}{
+		{"", "Available commands:\n" +
+			"• `.page <user>`: pages a user\n" +
+			"• `.page-sre <user>`: pages a user (page/sre)\n" +
+			"• `.help [command]`: show this help, or the help of a command\n" +
+			"Plugins without documentation: echo"},
+		{"p", "`.page <user>`\npages a user\nAliases: p"},
+		{".page-sre", "`.page-sre <user>`\npages a user"},
+		{"echo", "Unknown command `echo`. Try `.help` for a list of commands."},
+	} {
+		if got := b.help(tc.cmd); got != tc.want {
+			t.Errorf("help(%q) = %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+}
+
+func TestUsageReply(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{}, newPagePlugin())
+
+	send(srv.SendMessage("C1", "U1", ".p"))
+	want := "Invalid usage: missing user\nUsage: `.page <user>`"
+	if p := expectPost(t, srv); p.Text != want {
+		t.Errorf("got %q, want %q", p.Text, want)
+	}
+	expectNoPost(t, srv)
+}
@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// serveHTTP starts the HTTP listener on addr, which serves the metrics on
+// /metrics and the health checks on /healthz and /readyz. The returned
+// function shuts it down.
+func (b *Bot) serveHTTP(addr string) (func(context.Context) error, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on http_addr: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", b.Metrics)
+	mux.Handle("/healthz", b.healthHandler(false))
+	mux.Handle("/readyz", b.healthHandler(true))
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			b.Log.Errorf("HTTP server failed: %v", err)
+		}
+	}()
+	b.Log.Infof("Serving metrics and health checks on http://%s", ln.Addr())
+	return srv.Shutdown, nil
+}
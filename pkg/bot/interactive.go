@@ -0,0 +1,393 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// DefaultAckTimeout is how long the bot waits for a plugin to handle a
+// submitted view, so that it can report validation errors, before
+// acknowledging it. Slack requires an acknowledgement within 3 seconds.
+var DefaultAckTimeout = 2500 * time.Millisecond
+
+// DefaultViewTTL is how long the state of an open modal view is kept.
+var DefaultViewTTL = 24 * time.Hour
+
+// viewPrefix is the storage key prefix of the pending views.
+const viewPrefix = "interactions/views/"
+
+// Interaction outcomes, used as label values of slackbot_interactions_total,
+// in addition to the command outcomes.
+const outcomeInvalid = "invalid"
+
+// pendingView is the state of a modal view opened by a plugin, kept in the
+// storage so that the view can be submitted after a restart of the bot.
+type pendingView struct {
+	// Origin is the message or command that opened the view.
+	Origin  *chat.Message `json:"origin,omitempty"`
+	State   []byte        `json:"state,omitempty"`
+	Expires time.Time     `json:"expires"`
+}
+
+func (b *Bot) saveView(ctx context.Context, id string, pv *pendingView) error {
+	pv.Expires = time.Now().Add(DefaultViewTTL)
+	data, err := json.Marshal(pv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal view state: %w", err)
+	}
+	if err := b.store.Put(ctx, viewPrefix+id, data); err != nil {
+		return fmt.Errorf("failed to save view state: %w", err)
+	}
+	return nil
+}
+
+// loadView returns the state of a view, or nil if it is unknown or expired.
+func (b *Bot) loadView(ctx context.Context, id string) (*pendingView, error) {
+	data, err := b.store.Get(ctx, viewPrefix+id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load view state: %w", err)
+	}
+	var pv pendingView
+	if err := json.Unmarshal(data, &pv); err != nil {
+		return nil, fmt.Errorf("invalid view state: %w", err)
+	}
+	if time.Now().After(pv.Expires) {
+		return nil, nil
+	}
+	return &pv, nil
+}
+
+func (b *Bot) deleteView(ctx context.Context, id string) {
+	if err := b.store.Delete(ctx, viewPrefix+id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		b.Log.Warnf("Failed to delete the state of view %s: %v", id, err)
+	}
+}
+
+// pruneViews deletes the state of the expired views.
+func (b *Bot) pruneViews(ctx context.Context) {
+	keys, err := b.store.List(ctx, viewPrefix)
+	if err != nil {
+		b.Log.Warnf("Failed to list pending views: %v", err)
+		return
+	}
+	for _, key := range keys {
+		id := strings.TrimPrefix(key, viewPrefix)
+		if pv, err := b.loadView(ctx, id); err != nil || pv == nil {
+			b.deleteView(ctx, id)
+		}
+	}
+}
+
+// viewClient is a chat.Client that records the origin and the state of the
+// modal views opened by plugins, see pendingView.
+type viewClient struct {
+	chat.Client
+	b      *Bot
+	origin *chat.Message
+}
+
+func (c viewClient) OpenView(ctx context.Context, triggerID string, view *chat.View) (string, error) {
+	id, err := c.Client.OpenView(ctx, triggerID, view)
+	if err != nil {
+		return "", err
+	}
+	return id, c.b.saveView(ctx, id, &pendingView{Origin: c.origin, State: view.State})
+}
+
+func (c viewClient) PushView(ctx context.Context, triggerID string, view *chat.View) (string, error) {
+	id, err := c.Client.PushView(ctx, triggerID, view)
+	if err != nil {
+		return "", err
+	}
+	return id, c.b.saveView(ctx, id, &pendingView{Origin: c.origin, State: view.State})
+}
+
+func (c viewClient) UpdateView(ctx context.Context, viewID string, view *chat.View) error {
+	if err := c.Client.UpdateView(ctx, viewID, view); err != nil {
+		return err
+	}
+	pv, err := c.b.loadView(ctx, viewID)
+	if err != nil {
+		return err
+	}
+	if pv == nil {
+		pv = &pendingView{Origin: c.origin}
+	}
+	pv.State = view.State
+	return c.b.saveView(ctx, viewID, pv)
+}
+
+// handleInteraction routes an interactive payload to the plugin owning the
+// action or the view, and acknowledges it.
+func (b *Bot) handleInteraction(client *socketmode.Client, chatClient chat.Client, req *socketmode.Request, cb *slack.InteractionCallback) {
+	switch cb.Type {
+	case slack.InteractionTypeBlockActions:
+		client.Ack(*req)
+		for _, action := range cb.ActionCallback.BlockActions {
+			in := b.newInteraction(cb, chat.InteractionBlockAction, action.ActionID)
+			in.Value = firstValue(actionValues(action))
+			b.dispatchInteraction(chatClient, action.ActionID, in, nil)
+		}
+	case slack.InteractionTypeViewSubmission:
+		in := b.newInteraction(cb, chat.InteractionViewSubmission, cb.View.CallbackID)
+		result := make(chan error, 1)
+		dispatched := b.dispatchInteraction(chatClient, cb.View.CallbackID, in, func(err error) {
+			var verr chat.ViewErrors
+			if !errors.As(err, &verr) {
+				// the view is closed.
+				b.deleteView(context.Background(), cb.View.ID)
+			}
+			result <- err
+		})
+		if !dispatched {
+			client.Ack(*req)
+			return
+		}
+		// do not block the event loop while waiting for the plugin.
+		go func() {
+			timer := time.NewTimer(DefaultAckTimeout)
+			defer timer.Stop()
+			select {
+			case err := <-result:
+				var verr chat.ViewErrors
+				if errors.As(err, &verr) {
+					client.Ack(*req, slack.NewErrorsViewSubmissionResponse(verr))
+					return
+				}
+			case <-timer.C:
+			}
+			client.Ack(*req)
+		}()
+	case slack.InteractionTypeViewClosed:
+		client.Ack(*req)
+		in := b.newInteraction(cb, chat.InteractionViewClosed, cb.View.CallbackID)
+		b.dispatchInteraction(chatClient, cb.View.CallbackID, in, func(error) {
+			b.deleteView(context.Background(), cb.View.ID)
+		})
+	default:
+		client.Ack(*req)
+		b.Log.Debugf("Unsupported interaction: %s", cb.Type)
+	}
+}
+
+// newInteraction converts an interactive payload to a chat.Interaction, for
+// the given action or callback ID.
+func (b *Bot) newInteraction(cb *slack.InteractionCallback, typ, id string) *chat.Interaction {
+	_, local := chat.SplitActionID(id)
+	in := chat.Interaction{
+		Type:      typ,
+		ActionID:  local,
+		User:      cb.User.ID,
+		Channel:   cb.Channel.ID,
+		TriggerID: cb.TriggerID,
+		ViewID:    cb.View.ID,
+	}
+	if cb.Container.Type == "message" && cb.Container.MessageTs != "" {
+		in.Message = &chat.Message{
+			Channel:         cb.Container.ChannelID,
+			User:            cb.Message.User,
+			Text:            cb.Message.Text,
+			Timestamp:       cb.Container.MessageTs,
+			ThreadTimestamp: cb.Container.ThreadTs,
+		}
+		if in.Message.ThreadTimestamp == "" {
+			in.Message.ThreadTimestamp = cb.Message.ThreadTimestamp
+		}
+		if in.Channel == "" {
+			in.Channel = in.Message.Channel
+		}
+	}
+	if cb.View.State != nil {
+		in.Values = make(map[string][]string)
+		for _, actions := range cb.View.State.Values {
+			for actionID, action := range actions {
+				_, local := chat.SplitActionID(actionID)
+				action := action
+				in.Values[local] = actionValues(&action)
+			}
+		}
+	}
+	return &in
+}
+
+// actionValues returns the values of a button, a menu or an input.
+func actionValues(a *slack.BlockAction) []string {
+	var values []string
+	add := func(v ...string) {
+		for _, s := range v {
+			if s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	add(a.Value, a.SelectedOption.Value)
+	for _, o := range a.SelectedOptions {
+		add(o.Value)
+	}
+	add(a.SelectedUser, a.SelectedChannel, a.SelectedConversation, a.SelectedDate, a.SelectedTime)
+	add(a.SelectedUsers...)
+	add(a.SelectedChannels...)
+	add(a.SelectedConversations...)
+	return values
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// dispatchInteraction runs the interaction handler of the plugin owning id
+// on the worker pool. done, if not nil, is called with the result of the
+// handler. It returns false if the interaction could not be dispatched.
+func (b *Bot) dispatchInteraction(client chat.Client, id string, in *chat.Interaction, done func(error)) bool {
+	cfg := b.Config()
+	ns, _ := chat.SplitActionID(id)
+	log := b.Log.WithFields(logrus.Fields{
+		"interaction": in.Type,
+		"action_id":   id,
+		"user":        in.User,
+		"channel":     in.Channel,
+	})
+	plugin := cfg.plugin(ns)
+	if plugin == nil {
+		log.Warnf("No plugin instance %q for the interaction, ignoring it", ns)
+		return false
+	}
+	if _, ok := plugin.Plugin.(plugins.InteractionHandler); !ok {
+		log.Warnf("Plugin %s does not handle interactions, ignoring it", plugin.Name())
+		return false
+	}
+	key := in.Channel
+	if in.ViewID != "" {
+		key = "view/" + in.ViewID
+	} else if in.Message != nil {
+		key = threadKey(in.Message)
+	}
+	j := job{
+		run: func(ctx context.Context) {
+			ctx = logging.NewContext(ctx, log.WithField("plugin", plugin.Name()))
+			err := b.runInteraction(ctx, client, plugin, in)
+			if done != nil {
+				done(err)
+			}
+		},
+		onTimeout: func() {
+			log.Warnf("Interaction handler timed out")
+		},
+		timeout: cfg.CommandTimeout,
+	}
+	if !b.dispatcher.dispatch(key, j) {
+		log.Warnf("Too many pending commands, dropping interaction")
+		return false
+	}
+	return true
+}
+
+// runInteraction runs the interaction handler of a plugin, and reports its
+// errors to the user.
+func (b *Bot) runInteraction(ctx context.Context, client chat.Client, plugin *plugins.Instance, in *chat.Interaction) error {
+	log := logging.FromContext(ctx)
+	origin := in.Message
+	if in.ViewID != "" {
+		pv, err := b.loadView(ctx, in.ViewID)
+		if err != nil {
+			log.Warnf("%v", err)
+		} else if pv != nil {
+			in.State = pv.State
+			if origin == nil {
+				origin = pv.Origin
+			}
+			if in.Channel == "" && pv.Origin != nil {
+				in.Channel = pv.Origin.Channel
+			}
+			if in.Message == nil {
+				in.Message = pv.Origin
+			}
+		}
+	}
+	client = viewClient{Client: client, b: b, origin: origin}
+	if !b.authorizeInteraction(ctx, client, plugin, in) {
+		b.metrics.interactions.Inc(plugin.Name(), in.Type, outcomeDenied)
+		return errDenied
+	}
+
+	start := time.Now()
+	err := b.invokeInteraction(ctx, plugin, client, in)
+	b.metrics.commandDuration.Observe(time.Since(start).Seconds(), plugin.Name())
+	var (
+		perr *PanicError
+		verr chat.ViewErrors
+	)
+	switch {
+	case err == nil:
+		b.metrics.interactions.Inc(plugin.Name(), in.Type, outcomeOK)
+	case errors.As(err, &verr):
+		b.metrics.interactions.Inc(plugin.Name(), in.Type, outcomeInvalid)
+		log.Infof("Invalid view submission: %v", err)
+	default:
+		outcome := outcomeError
+		if errors.As(err, &perr) {
+			outcome = outcomePanic
+		} else if ctx.Err() == context.DeadlineExceeded {
+			outcome = outcomeTimeout
+		}
+		b.metrics.interactions.Inc(plugin.Name(), in.Type, outcome)
+		b.replyInteractionError(ctx, client, in, err)
+	}
+	return err
+}
+
+// invokeInteraction calls the plugin's interaction handler, recovering from
+// panics.
+func (b *Bot) invokeInteraction(ctx context.Context, plugin *plugins.Instance, client chat.Client, in *chat.Interaction) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return plugin.Plugin.(plugins.InteractionHandler).HandleInteraction(ctx, client, in)
+}
+
+// replyInteractionError logs an interaction error with a new error ID, and
+// shows the error ID to the user with an ephemeral message.
+func (b *Bot) replyInteractionError(ctx context.Context, client chat.Client, in *chat.Interaction, err error) {
+	id := newErrorID()
+	log := logging.FromContext(ctx).WithField("error_id", id)
+	if perr, ok := err.(*PanicError); ok {
+		log.WithField("stack", string(perr.Stack)).Errorf("Plugin panicked: %v", perr.Value)
+	} else {
+		log.Errorf("Interaction failed: %v", err)
+	}
+	if in.Channel == "" {
+		return
+	}
+	msg := fmt.Sprintf("Sorry, your action failed (error ID: `%s`).", id)
+	if b.Config().ShowErrors {
+		msg += fmt.Sprintf("\n> %v", err)
+	}
+	threadTS := ""
+	if in.Message != nil {
+		threadTS = in.Message.ThreadTimestamp
+	}
+	if err := client.PostEphemeral(ctx, in.User, &chat.OutgoingMessage{Channel: in.Channel, ThreadTS: threadTS, Text: msg}); err != nil {
+		log.Errorf("Failed to report the error: %v", err)
+	}
+}
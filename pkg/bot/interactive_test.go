@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/acl"
+	"github.com/insomniacslk/slackbot/pkg/actions"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// buttonPlugin is a testPlugin that handles the clicks on its buttons.
+type buttonPlugin struct {
+	testPlugin
+}
+
+func (p *buttonPlugin) HandleInteraction(ctx context.Context, client chat.Client, in *chat.Interaction) error {
+	return actions.Say(ctx, client, in.Channel, "", "clicked %s by %s", in.ActionID, in.User)
+}
+
+func TestInteractionAccessDenied(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	cfg := Config{Access: acl.Config{
+		Rules: []acl.Rule{{Action: acl.Deny, Plugins: []string{"buttons"}, Subjects: acl.Subjects{Users: []string{"U2"}}}},
+	}}
+	p := &buttonPlugin{testPlugin{name: "buttons"}}
+	startBot(t, srv, &cfg, p)
+
+	send(srv.SendBlockAction("C1", "U1", "1.1", "buttons:ack", ""))
+	if got := expectPost(t, srv); got.Text != "clicked ack by U1" {
+		t.Errorf("got %q, want the plugin reply", got.Text)
+	}
+	send(srv.SendBlockAction("C1", "U2", "1.1", "buttons:ack", ""))
+	got := expectPost(t, srv)
+	if got.Ephemeral != "U2" || !strings.Contains(got.Text, "not allowed") {
+		t.Errorf("got %q (ephemeral to %q), want an ephemeral denial to U2", got.Text, got.Ephemeral)
+	}
+	expectNoPost(t, srv)
+}
+
+func TestInteractiveWithoutStorage(t *testing.T) {
+	srv := newServer(t)
+	hook := test.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+	startBot(t, srv, &Config{}, &buttonPlugin{testPlugin{name: "buttons"}}, echoPlugin())
+
+	var warnings []string
+	for _, e := range hook.AllEntries() {
+		if e.Level == logrus.WarnLevel && strings.Contains(e.Message, "storage_path") {
+			warnings = append(warnings, fmt.Sprint(e.Data["plugin"]))
+		}
+	}
+	if len(warnings) != 1 || warnings[0] != "buttons" {
+		t.Errorf("got storage warnings for %q, want one for buttons", warnings)
+	}
+}
@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/scheduler"
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultHTTPTimeout is the timeout of the HTTP client passed to plugins.
+var DefaultHTTPTimeout = 30 * time.Second
+
+// openStorage opens the storage configured in Config.StoragePath, or an
+// in-memory storage if not set, warning about the interactive plugins. The
+// returned function closes it.
+func (b *Bot) openStorage() (storage.Store, func() error, error) {
+	path := b.Config().StoragePath
+	if path == "" {
+		for _, p := range b.Config().Plugins {
+			if _, ok := p.Plugin.(plugins.InteractionHandler); ok {
+				b.Log.WithField("plugin", p.Name()).Warnf("No storage_path set, the modal views opened by the plugin cannot be submitted after a restart")
+			}
+		}
+		return storage.NewMemory(), func() error { return nil }, nil
+	}
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	return db, db.Close, nil
+}
+
+// newServices returns the services for a plugin instance.
+func (b *Bot) newServices(cfg *Config, inst *plugins.Instance) *plugins.Services {
+	return &plugins.Services{
+		Name:      inst.Name(),
+		CmdPrefix: cfg.CmdPrefix,
+		Chat:      b.chat,
+		Outbound:  b.outbound,
+		Log:       b.Log.WithField("plugin", inst.Name()),
+		Storage:   storage.WithPrefix(b.store, "plugins/"+inst.Name()+"/"),
+		Scheduler: scheduler.New(),
+		HTTPClient: &http.Client{
+			Timeout:   DefaultHTTPTimeout,
+			Transport: instrumentedTransport{base: http.DefaultTransport, plugin: inst.Name(), m: b.metrics},
+		},
+		Metrics:     b.Metrics,
+		Credentials: cfg.Credentials,
+		Auth:        b,
+	}
+}
+
+// startPlugins initializes and starts the plugin instances that were not
+// started yet. ctx is the context of the bot's run, and is passed to the
+// plugins' Start. On error, the instances started by this call are stopped
+// and the others are left untouched. Must be called with reloadMu held.
+func (b *Bot) startPlugins(ctx context.Context, cfg *Config, instances []*plugins.Instance) error {
+	var started []*plugins.Instance
+	for _, inst := range instances {
+		if inst.Services != nil {
+			// already started, e.g. reused by a configuration reload.
+			continue
+		}
+		inst.Services = b.newServices(cfg, inst)
+		if err := startPlugin(ctx, inst, cfg.shutdownTimeout()); err != nil {
+			stopCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout())
+			defer cancel()
+			// the failed instance was not started, but it may have
+			// scheduled jobs in Init.
+			if err := inst.Services.Scheduler.Stop(stopCtx); err != nil {
+				b.Log.WithField("plugin", inst.Name()).Errorf("Failed to stop scheduler: %v", err)
+			}
+			stopPlugins(stopCtx, started, b.Log)
+			return err
+		}
+		started = append(started, inst)
+	}
+	return nil
+}
+
+// startPlugin initializes and starts a plugin instance. Start gets a context
+// derived from ctx, which is also cancelled if Start does not return within
+// timeout: the timeout only applies to the Start call, not to the background
+// work of the plugin. A panic in Init or Start, e.g. when registering a
+// metric that conflicts with an existing one, is returned as a *PanicError.
+func startPlugin(ctx context.Context, inst *plugins.Instance, timeout time.Duration) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to start plugin %s: %w", inst.Name(), &PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	if i, ok := inst.Plugin.(plugins.Initializer); ok {
+		if err := i.Init(inst.Services); err != nil {
+			return fmt.Errorf("failed to initialize plugin %s: %w", inst.Name(), err)
+		}
+	}
+	s, ok := inst.Plugin.(plugins.Starter)
+	if !ok {
+		return nil
+	}
+	startCtx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	err = s.Start(startCtx)
+	if !timer.Stop() && err == nil {
+		err = fmt.Errorf("did not start within %s", timeout)
+	}
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to start plugin %s: %w", inst.Name(), err)
+	}
+	return nil
+}
+
+// stopPlugins calls Stop on the plugin instances that implement
+// plugins.Stopper, then stops their scheduler.
+func stopPlugins(ctx context.Context, ps []*plugins.Instance, log *logrus.Entry) {
+	for _, p := range ps {
+		if s, ok := p.Plugin.(plugins.Stopper); ok {
+			if err := s.Stop(ctx); err != nil {
+				log.WithField("plugin", p.Name()).Errorf("Failed to stop plugin: %v", err)
+			}
+		}
+		if p.Services != nil {
+			if err := p.Services.Scheduler.Stop(ctx); err != nil {
+				log.WithField("plugin", p.Name()).Errorf("Failed to stop scheduler: %v", err)
+			}
+		}
+	}
+}
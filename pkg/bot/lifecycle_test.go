@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/metrics"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// metricPlugin registers a counter in Init.
+type metricPlugin struct {
+	testPlugin
+}
+
+func (p *metricPlugin) Init(svc *plugins.Services) error {
+	svc.Metrics.Counter("slackbot_test_total", "A test counter.")
+	return nil
+}
+
+func TestStartPluginPanic(t *testing.T) {
+	reg := metrics.NewRegistry()
+	// e.g. registered by another plugin, or by the previous version of the
+	// plugin before a reload.
+	reg.Gauge("slackbot_test_total", "A test gauge.")
+	p := &metricPlugin{testPlugin{name: "metric", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		return nil
+	}}}
+	inst, err := plugins.NewInstance("metric", p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst.Services = &plugins.Services{Metrics: reg}
+	err = startPlugin(context.Background(), inst, time.Second)
+	var perr *PanicError
+	if !errors.As(err, &perr) {
+		t.Errorf("got %v, want a panic error", err)
+	}
+}
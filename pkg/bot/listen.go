@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// listenerType is the type label of the messages handled by the listeners in
+// slackbot_plugin_events_total.
+const listenerType = "message"
+
+// handleListeners matches a message that is not a command against the
+// patterns of the message listeners, and runs the matching ones on the
+// worker pool.
+func (b *Bot) handleListeners(client chat.Client, ev *slackevents.MessageEvent) {
+	type match struct {
+		plugin *plugins.Instance
+		m      *chat.Match
+	}
+	var matches []match
+	for _, plugin := range b.Config().Plugins {
+		l, ok := plugin.Plugin.(plugins.MessageListener)
+		if !ok {
+			continue
+		}
+		m := chat.Match{Message: messageFromEvent(ev), ChannelType: ev.ChannelType}
+		found := false
+		for _, re := range l.Patterns() {
+			all := re.FindAllStringSubmatch(ev.Text, -1)
+			m.Matches = append(m.Matches, all)
+			found = found || all != nil
+		}
+		if found {
+			matches = append(matches, match{plugin: plugin, m: &m})
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	msg := messageFromEvent(ev)
+	log := b.Log.WithFields(logrus.Fields{
+		"event":     listenerType,
+		"user":      msg.User,
+		"channel":   msg.Channel,
+		"thread_ts": msg.ThreadTimestamp,
+	})
+	b.dispatchListeners(threadKey(&msg), log, func(ctx context.Context) {
+		for _, lm := range matches {
+			l := lm.plugin.Plugin.(plugins.MessageListener)
+			b.runListener(ctx, lm.plugin, listenerType, func(ctx context.Context) error {
+				return l.HandleMatch(ctx, client, lm.m)
+			})
+		}
+	})
+}
+
+// handleSubscriptions runs the plugins subscribed to an Events API event on
+// the worker pool.
+func (b *Bot) handleSubscriptions(client chat.Client, apiEvent *slackevents.EventsAPIEvent) {
+	typ := apiEvent.InnerEvent.Type
+	var subscribers []*plugins.Instance
+	for _, plugin := range b.Config().Plugins {
+		if s, ok := plugin.Plugin.(plugins.EventSubscriber); ok && contains(s.Events(), typ) {
+			subscribers = append(subscribers, plugin)
+		}
+	}
+	if len(subscribers) == 0 || b.ignoreEvent(apiEvent) {
+		return
+	}
+	ev := eventFromSlack(apiEvent)
+	log := b.Log.WithFields(logrus.Fields{
+		"event":   typ,
+		"user":    ev.User,
+		"channel": ev.Channel,
+	})
+	b.dispatchListeners("event/"+ev.Channel, log, func(ctx context.Context) {
+		for _, plugin := range subscribers {
+			s := plugin.Plugin.(plugins.EventSubscriber)
+			b.runListener(ctx, plugin, typ, func(ctx context.Context) error {
+				// every subscriber gets its own copy.
+				ev := *ev
+				return s.HandleEvent(ctx, client, &ev)
+			})
+		}
+	})
+}
+
+// ignoreEvent returns true if an event is a message or a mention sent by the
+// bot itself or by an ignored bot, which must not reach the subscribers, so
+// that the bot does not react to its own messages. The subtypes are not
+// filtered, since the subscribers may want e.g. the edits. The ignored events
+// were already counted by the message handlers.
+func (b *Bot) ignoreEvent(apiEvent *slackevents.EventsAPIEvent) bool {
+	var user, botID string
+	switch iev := apiEvent.InnerEvent.Data.(type) {
+	case *slackevents.MessageEvent:
+		user, botID = iev.User, iev.BotID
+		if iev.Message != nil && user == "" {
+			// e.g. message_changed, whose sender is in the message.
+			user, botID = iev.Message.User, iev.Message.BotID
+		}
+	case *slackevents.AppMentionEvent:
+		user, botID = iev.User, iev.BotID
+	default:
+		return false
+	}
+	return b.ignoreMessage(user, botID, "") != ""
+}
+
+// dispatchListeners runs the listeners or subscribers of a message or event
+// on the worker pool.
+func (b *Bot) dispatchListeners(key string, log *logrus.Entry, run func(ctx context.Context)) {
+	j := job{
+		run: func(ctx context.Context) {
+			run(logging.NewContext(ctx, log))
+		},
+		onTimeout: func() {
+			log.Warnf("Listeners timed out")
+		},
+		timeout: b.Config().CommandTimeout,
+	}
+	if !b.dispatcher.dispatch(key, j) {
+		log.Warnf("Too many pending commands, dropping event")
+	}
+}
+
+// runListener runs the listener or subscriber of a plugin, recovering from
+// panics, and logs its errors. There is no reply to the user, who did not
+// invoke the plugin explicitly.
+func (b *Bot) runListener(ctx context.Context, plugin *plugins.Instance, typ string, handle func(ctx context.Context) error) {
+	log := logging.FromContext(ctx).WithField("plugin", plugin.Name())
+	ctx = logging.NewContext(ctx, log)
+	start := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return handle(ctx)
+	}()
+	b.metrics.commandDuration.Observe(time.Since(start).Seconds(), plugin.Name())
+	var perr *PanicError
+	switch {
+	case err == nil:
+		b.metrics.pluginEvents.Inc(plugin.Name(), typ, outcomeOK)
+	case errors.As(err, &perr):
+		b.metrics.pluginEvents.Inc(plugin.Name(), typ, outcomePanic)
+		log.WithFields(logrus.Fields{"error_id": newErrorID(), "stack": string(perr.Stack)}).Errorf("Plugin panicked: %v", perr.Value)
+	case ctx.Err() == context.DeadlineExceeded:
+		b.metrics.pluginEvents.Inc(plugin.Name(), typ, outcomeTimeout)
+		log.Errorf("Listener timed out: %v", err)
+	default:
+		b.metrics.pluginEvents.Inc(plugin.Name(), typ, outcomeError)
+		log.WithField("error_id", newErrorID()).Errorf("Listener failed: %v", err)
+	}
+}
+
+// eventFromSlack converts an Events API event to a chat.Event.
+func eventFromSlack(apiEvent *slackevents.EventsAPIEvent) *chat.Event {
+	ev := chat.Event{Type: apiEvent.InnerEvent.Type}
+	if cb, ok := apiEvent.Data.(*slackevents.EventsAPICallbackEvent); ok && cb.InnerEvent != nil {
+		ev.Raw = []byte(*cb.InnerEvent)
+	}
+	switch iev := apiEvent.InnerEvent.Data.(type) {
+	case *slackevents.ReactionAddedEvent:
+		ev.User, ev.Reaction, ev.ItemUser = iev.User, iev.Reaction, iev.ItemUser
+		ev.Channel = iev.Item.Channel
+		ev.Item = chat.MessageRef{Channel: iev.Item.Channel, Timestamp: iev.Item.Timestamp}
+	case *slackevents.ReactionRemovedEvent:
+		ev.User, ev.Reaction, ev.ItemUser = iev.User, iev.Reaction, iev.ItemUser
+		ev.Channel = iev.Item.Channel
+		ev.Item = chat.MessageRef{Channel: iev.Item.Channel, Timestamp: iev.Item.Timestamp}
+	case *slackevents.MemberJoinedChannelEvent:
+		ev.User, ev.Channel, ev.Inviter = iev.User, iev.Channel, iev.Inviter
+	case *slackevents.MemberLeftChannelEvent:
+		ev.User, ev.Channel = iev.User, iev.Channel
+	case *slackevents.ChannelCreatedEvent:
+		ev.User, ev.Channel, ev.Name = iev.Channel.Creator, iev.Channel.ID, iev.Channel.Name
+	case *slackevents.MessageEvent:
+		ev.User, ev.Channel = iev.User, iev.Channel
+	case *slackevents.AppMentionEvent:
+		ev.User, ev.Channel = iev.User, iev.Channel
+	}
+	return &ev
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
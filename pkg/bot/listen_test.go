@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/actions"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+)
+
+// subscriberPlugin is a testPlugin that says who sent the message events.
+type subscriberPlugin struct {
+	testPlugin
+}
+
+func (p *subscriberPlugin) Events() []string { return []string{"message"} }
+
+func (p *subscriberPlugin) HandleEvent(ctx context.Context, client chat.Client, ev *chat.Event) error {
+	return actions.Say(ctx, client, ev.Channel, "", "message from %s", ev.User)
+}
+
+func TestSubscriberIgnoresSelf(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{IgnoreBots: []string{"BOTHER"}}, &subscriberPlugin{testPlugin{name: "sub"}})
+
+	own := messageEvent("C1", srv.BotUserID, "1.1", "message from U1")
+	own["bot_id"] = srv.BotID
+	send(srv.SendEvent(own))
+	other := messageEvent("C1", "UOTHER", "2.2", "hello")
+	other["bot_id"] = "BOTHER"
+	send(srv.SendEvent(other))
+	send(srv.SendEvent(messageEvent("C1", "U1", "3.3", "hello")))
+	// the reply of the subscriber does not trigger it again.
+	if p := expectPost(t, srv); p.Text != "message from U1" {
+		t.Errorf("got %q, want %q", p.Text, "message from U1")
+	}
+	expectNoPost(t, srv)
+}
+
+// ticketPlugin is a testPlugin that lists the ticket IDs mentioned in the
+// messages.
+type ticketPlugin struct {
+	testPlugin
+}
+
+func (p *ticketPlugin) Patterns() []*regexp.Regexp {
+	return []*regexp.Regexp{regexp.MustCompile(`\b([A-Z]+)-([0-9]+)\b`)}
+}
+
+func (p *ticketPlugin) HandleMatch(ctx context.Context, client chat.Client, m *chat.Match) error {
+	var ids []string
+	for _, match := range m.Matches[0] {
+		ids = append(ids, match[1]+"#"+match[2])
+	}
+	return actions.Say(ctx, client, m.Message.Channel, "", "tickets %s", strings.Join(ids, " "))
+}
+
+func TestMessageListener(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{}, &ticketPlugin{testPlugin{name: "tickets"}}, echoPlugin())
+
+	send(srv.SendMessage("C1", "U1", "no ticket here"))
+	expectNoPost(t, srv)
+	send(srv.SendMessage("C1", "U1", "see OPS-1 and OPS-22"))
+	if p := expectPost(t, srv); p.Text != "tickets OPS#1 OPS#22" || p.Channel != "C1" {
+		t.Errorf("got %q in %s, want the matches in C1", p.Text, p.Channel)
+	}
+	// commands are not matched.
+	send(srv.SendMessage("C1", "U1", ".echo OPS-3"))
+	if p := expectPost(t, srv); p.Text != "echo: OPS-3" {
+		t.Errorf("got %q, want the command reply", p.Text)
+	}
+	expectNoPost(t, srv)
+}
+
+// eventPlugin is a testPlugin that describes the reactions and the channel
+// joins.
+type eventPlugin struct {
+	testPlugin
+}
+
+func (p *eventPlugin) Events() []string {
+	return []string{chat.EventReactionAdded, chat.EventMemberJoinedChannel}
+}
+
+func (p *eventPlugin) HandleEvent(ctx context.Context, client chat.Client, ev *chat.Event) error {
+	text := fmt.Sprintf("%s by %s", ev.Type, ev.User)
+	switch ev.Type {
+	case chat.EventReactionAdded:
+		text += fmt.Sprintf(": %s on %s/%s of %s", ev.Reaction, ev.Item.Channel, ev.Item.Timestamp, ev.ItemUser)
+	case chat.EventMemberJoinedChannel:
+		text += ", invited by " + ev.Inviter
+	}
+	return actions.Say(ctx, client, ev.Channel, "", "%s", text)
+}
+
+func TestEventSubscriber(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	startBot(t, srv, &Config{}, &eventPlugin{testPlugin{name: "events"}})
+
+	send(srv.SendEvent(map[string]interface{}{
+		"type":      "reaction_added",
+		"user":      "U1",
+		"reaction":  "eyes",
+		"item_user": "U2",
+		"item":      map[string]interface{}{"type": "message", "channel": "C1", "ts": "1.1"},
+	}))
+	if p := expectPost(t, srv); p.Text != "reaction_added by U1: eyes on C1/1.1 of U2" || p.Channel != "C1" {
+		t.Errorf("got %q in %s, want the reaction in C1", p.Text, p.Channel)
+	}
+	send(srv.SendEvent(map[string]interface{}{
+		"type":    "member_joined_channel",
+		"user":    "U3",
+		"channel": "C2",
+		"inviter": "U1",
+	}))
+	if p := expectPost(t, srv); p.Text != "member_joined_channel by U3, invited by U1" || p.Channel != "C2" {
+		t.Errorf("got %q in %s, want the join in C2", p.Text, p.Channel)
+	}
+	// the events the plugin is not subscribed to are not delivered.
+	send(srv.SendEvent(map[string]interface{}{
+		"type":    "member_left_channel",
+		"user":    "U3",
+		"channel": "C2",
+	}))
+	send(srv.SendMessage("C1", "U1", "hello"))
+	expectNoPost(t, srv)
+}
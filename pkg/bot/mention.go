@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// leadingMention matches a user mention at the beginning of a message, e.g.
+// "<@U123> " or "<@U123|bot>: ", capturing the user ID.
+var leadingMention = regexp.MustCompile(`^\s*<@([A-Z0-9]+)(?:\|[^>]*)?>[\s:,]*`)
+
+// stripMention removes the mention of the bot from the beginning of text. It
+// returns false if text does not start with a mention of the bot. If the bot
+// user ID is unknown, any leading mention is accepted, since Slack only sends
+// app_mention events for messages that mention the bot.
+func (b *Bot) stripMention(text string) (string, bool) {
+	m := leadingMention.FindStringSubmatchIndex(text)
+	if m == nil {
+		return "", false
+	}
+	if b.selfID != "" && text[m[2]:m[3]] != b.selfID {
+		return "", false
+	}
+	return strings.TrimSpace(text[m[1]:]), true
+}
+
+// handleMention dispatches a message that starts with a mention of the bot
+// like a command, e.g. "@bot oncall sre" like ".oncall sre". The command
+// prefix is optional after the mention. A bare mention gets a short help.
+func (b *Bot) handleMention(client chat.Client, ev *slackevents.AppMentionEvent) {
+	if reason := b.ignoreMessage(ev.User, ev.BotID, ""); reason != "" {
+		b.metrics.ignoredEvents.Inc(reason)
+		return
+	}
+	text, ok := b.stripMention(ev.Text)
+	if !ok {
+		// the bot is mentioned in the middle of a message, which is not a
+		// command.
+		b.Log.Debugf("Ignored mention in %s: not at the beginning of the message", ev.Channel)
+		return
+	}
+	channelType := channelTypeFromID(ev.Channel)
+	if channelType == chat.ChannelDirect && !b.Config().DisableDirectMessages {
+		// handled as a direct message.
+		return
+	}
+	name, arg := splitCmd(text)
+	if b.isCmd(name) {
+		name = name[len(b.Config().CmdPrefix):]
+	}
+	b.dispatchCommand(client, chat.Command{
+		Name:        name,
+		Arg:         arg,
+		Mention:     true,
+		ChannelType: channelType,
+		Message: chat.Message{
+			Channel:         ev.Channel,
+			User:            ev.User,
+			Text:            ev.Text,
+			Timestamp:       ev.TimeStamp,
+			ThreadTimestamp: ev.ThreadTimeStamp,
+		},
+	})
+}
+
+// handled returns true if a plugin handles the command name.
+func (b *Bot) handled(name string) bool {
+	for _, p := range b.Config().Plugins {
+		if p.Handles(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionHelp returns the short help shown when the bot is mentioned without
+// a command.
+func (b *Bot) mentionHelp() string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, p := range b.Config().Plugins {
+		for _, ci := range p.Commands() {
+			if !seen[ci.Name] {
+				seen[ci.Name] = true
+				names = append(names, "`"+ci.Name+"`")
+			}
+		}
+	}
+	sort.Strings(names)
+	msg := "Hi! Mention me followed by a command"
+	if len(names) > 0 {
+		msg += ", one of " + strings.Join(names, ", ")
+	}
+	return msg + ". " + b.helpHint(nil)
+}
+
+// addressed returns true if the command was explicitly addressed to the bot,
+// by mentioning it or in a direct message, rather than matched by prefix.
+func addressed(command *chat.Command) bool {
+	return command.Mention || command.ChannelType == chat.ChannelDirect
+}
+
+// helpHint tells how to get the full help in reply to command, which may be
+// nil.
+func (b *Bot) helpHint(command *chat.Command) string {
+	if command != nil && command.ChannelType == chat.ChannelDirect {
+		return fmt.Sprintf("Send `%s` for the list of commands.", HelpCmd)
+	}
+	return fmt.Sprintf("Send `%s%s`, or mention me with `%s`, for the list of commands.", b.Config().CmdPrefix, HelpCmd, HelpCmd)
+}
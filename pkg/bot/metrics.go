@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/metrics"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// Command outcomes, used as label values of slackbot_commands_total.
+const (
+	outcomeOK      = "ok"
+	outcomeUsage   = "usage"
+	outcomeError   = "error"
+	outcomePanic   = "panic"
+	outcomeTimeout = "timeout"
+	outcomeDenied  = "denied"
+)
+
+// botMetrics are the metrics collected by the bot.
+type botMetrics struct {
+	events          *metrics.Counter
+	commands        *metrics.Counter
+	commandDuration *metrics.Histogram
+	interactions    *metrics.Counter
+	pluginEvents    *metrics.Counter
+	ignoredEvents   *metrics.Counter
+	slackCalls      *metrics.Counter
+	slackErrors     *metrics.Counter
+	httpRequests    *metrics.Histogram
+	httpErrors      *metrics.Counter
+	reconnects      *metrics.Counter
+	connected       *metrics.Gauge
+}
+
+func newBotMetrics(r *metrics.Registry) *botMetrics {
+	return &botMetrics{
+		events:          r.Counter("slackbot_events_total", "Events received from Slack, by type.", "type"),
+		commands:        r.Counter("slackbot_commands_total", "Commands handled, by plugin and outcome.", "plugin", "outcome"),
+		commandDuration: r.Histogram("slackbot_command_duration_seconds", "Time spent handling commands, by plugin.", nil, "plugin"),
+		interactions:    r.Counter("slackbot_interactions_total", "Interactions with buttons, menus and modal views handled, by plugin, type and outcome.", "plugin", "type", "outcome"),
+		pluginEvents:    r.Counter("slackbot_plugin_events_total", "Messages and events handled by the plugin listeners and subscribers, by plugin, type and outcome.", "plugin", "type", "outcome"),
+		ignoredEvents:   r.Counter("slackbot_events_ignored_total", "Events ignored because they were sent by a bot, were a redelivery, or of an unhandled message subtype, by reason.", "reason"),
+		slackCalls:      r.Counter("slackbot_slack_api_calls_total", "Slack web API calls made by the bot and its plugins, by method.", "method"),
+		slackErrors:     r.Counter("slackbot_slack_api_errors_total", "Failed Slack web API calls, by method.", "method"),
+		httpRequests:    r.Histogram("slackbot_http_request_duration_seconds", "Duration of the HTTP requests made by plugins, e.g. to PagerDuty, by plugin, host and status code.", nil, "plugin", "host", "code"),
+		httpErrors:      r.Counter("slackbot_http_request_errors_total", "HTTP requests made by plugins that failed without a response, by plugin and host.", "plugin", "host"),
+		reconnects:      r.Counter("slackbot_socket_mode_reconnects_total", "Socket Mode reconnection attempts."),
+		connected:       r.Gauge("slackbot_socket_mode_connected", "Whether the Socket Mode connection is established."),
+	}
+}
+
+// eventType returns the type of a Socket Mode event, or the type of the inner
+// event for Events API callbacks.
+func eventType(ev socketmode.Event) string {
+	if ev.Type == socketmode.EventTypeEventsAPI {
+		if e, ok := ev.Data.(slackevents.EventsAPIEvent); ok && e.Type == slackevents.CallbackEvent {
+			return e.InnerEvent.Type
+		}
+	}
+	return string(ev.Type)
+}
+
+// instrumentedClient is a chat.Client that counts the API calls and errors.
+type instrumentedClient struct {
+	client chat.Client
+	m      *botMetrics
+}
+
+func (c instrumentedClient) observe(method string, err error) {
+	c.m.slackCalls.Inc(method)
+	if err != nil {
+		c.m.slackErrors.Inc(method)
+	}
+}
+
+func (c instrumentedClient) PostMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	ts, err := c.client.PostMessage(ctx, channel, threadTS, text)
+	c.observe("chat.postMessage", err)
+	return ts, err
+}
+
+func (c instrumentedClient) Post(ctx context.Context, msg *chat.OutgoingMessage) (chat.MessageRef, error) {
+	ref, err := c.client.Post(ctx, msg)
+	c.observe("chat.postMessage", err)
+	return ref, err
+}
+
+func (c instrumentedClient) PostEphemeral(ctx context.Context, user string, msg *chat.OutgoingMessage) error {
+	err := c.client.PostEphemeral(ctx, user, msg)
+	c.observe("chat.postEphemeral", err)
+	return err
+}
+
+func (c instrumentedClient) UpdateMessage(ctx context.Context, ref chat.MessageRef, msg *chat.OutgoingMessage) error {
+	err := c.client.UpdateMessage(ctx, ref, msg)
+	c.observe("chat.update", err)
+	return err
+}
+
+func (c instrumentedClient) DeleteMessage(ctx context.Context, ref chat.MessageRef) error {
+	err := c.client.DeleteMessage(ctx, ref)
+	c.observe("chat.delete", err)
+	return err
+}
+
+func (c instrumentedClient) OpenView(ctx context.Context, triggerID string, view *chat.View) (string, error) {
+	id, err := c.client.OpenView(ctx, triggerID, view)
+	c.observe("views.open", err)
+	return id, err
+}
+
+func (c instrumentedClient) PushView(ctx context.Context, triggerID string, view *chat.View) (string, error) {
+	id, err := c.client.PushView(ctx, triggerID, view)
+	c.observe("views.push", err)
+	return id, err
+}
+
+func (c instrumentedClient) UpdateView(ctx context.Context, viewID string, view *chat.View) error {
+	err := c.client.UpdateView(ctx, viewID, view)
+	c.observe("views.update", err)
+	return err
+}
+
+func (c instrumentedClient) GetUserByEmail(ctx context.Context, email string) (*chat.User, error) {
+	u, err := c.client.GetUserByEmail(ctx, email)
+	c.observe("users.lookupByEmail", err)
+	return u, err
+}
+
+func (c instrumentedClient) AddReaction(ctx context.Context, channel, ts, name string) error {
+	err := c.client.AddReaction(ctx, channel, ts, name)
+	c.observe("reactions.add", err)
+	return err
+}
+
+func (c instrumentedClient) RemoveReaction(ctx context.Context, channel, ts, name string) error {
+	err := c.client.RemoveReaction(ctx, channel, ts, name)
+	c.observe("reactions.remove", err)
+	return err
+}
+
+func (c instrumentedClient) GetUserGroupMembers(ctx context.Context, handle string) ([]string, error) {
+	members, err := c.client.GetUserGroupMembers(ctx, handle)
+	c.observe("usergroups.list", err)
+	return members, err
+}
+
+// instrumentedTransport is an http.RoundTripper that records the duration of
+// the requests made by a plugin.
+type instrumentedTransport struct {
+	base   http.RoundTripper
+	plugin string
+	m      *botMetrics
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.m.httpErrors.Inc(t.plugin, req.URL.Host)
+		return nil, err
+	}
+	t.m.httpRequests.Observe(time.Since(start).Seconds(), t.plugin, req.URL.Host, strconv.Itoa(resp.StatusCode))
+	return resp, nil
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/insomniacslk/slackbot/pkg/actions"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/mitchellh/go-homedir"
+)
+
+// keepRestartOnly copies from old to c the settings that cannot change
+// without restarting the bot, logging a warning for those that changed.
+func (b *Bot) keepRestartOnly(old, c *Config) {
+	var changed []string
+	// errors are reported by validate
+	_ = c.validateLog()
+	if c.BotName != old.BotName {
+		changed = append(changed, "bot_name")
+		c.BotName = old.BotName
+	}
+	if c.Log != old.Log {
+		changed = append(changed, "log")
+		c.Log = old.Log
+	}
+	c.LogFile = old.LogFile
+	if c.Debug != old.Debug {
+		changed = append(changed, "debug")
+		c.Debug = old.Debug
+	}
+	if err := c.Credentials.Resolve(); err != nil || c.Credentials != old.Credentials {
+		changed = append(changed, "credentials")
+		c.Credentials = old.Credentials
+	}
+	if c.StoragePath != "" {
+		if sp, err := homedir.Expand(c.StoragePath); err == nil {
+			c.StoragePath = sp
+		}
+	}
+	if c.StoragePath != old.StoragePath {
+		changed = append(changed, "storage_path")
+		c.StoragePath = old.StoragePath
+	}
+	if c.SlackAPIURL != old.SlackAPIURL {
+		changed = append(changed, "slack_api_url")
+		c.SlackAPIURL = old.SlackAPIURL
+	}
+	if c.HTTPAddr != old.HTTPAddr {
+		changed = append(changed, "http_addr")
+		c.HTTPAddr = old.HTTPAddr
+	}
+	// errors are reported by validate
+	_ = c.Outbound.Validate()
+	if c.Outbound != old.Outbound {
+		changed = append(changed, "outbound")
+		c.Outbound = old.Outbound
+	}
+	// errors are reported by validate
+	_ = c.Dedupe.Validate()
+	if c.Dedupe != old.Dedupe {
+		changed = append(changed, "dedupe")
+		c.Dedupe = old.Dedupe
+	}
+	// a zero value means the default, which was set by Validate
+	if c.Workers != 0 && c.Workers != old.Workers {
+		changed = append(changed, "workers")
+	}
+	c.Workers = old.Workers
+	if len(changed) > 0 {
+		b.Log.Warnf("changing %s requires a restart, keeping the previous values", strings.Join(changed, ", "))
+	}
+}
+
+// Reload replaces the bot's configuration with c, which must not have been
+// validated yet. The plugins whose configuration changed are loaded again and
+// swapped atomically with the previous instances, which are then stopped. If
+// the new configuration is invalid, the previous one is kept and the error is
+// logged and reported to the admin channel, if configured.
+func (b *Bot) Reload(c *Config) error {
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+
+	old := b.Config()
+	b.keepRestartOnly(old, c)
+	if err := c.validate(old); err != nil {
+		b.Log.Errorf("failed to reload configuration, keeping the previous one: %v", err)
+		if old.AdminChannel != "" && b.chat != nil {
+			actions.Say(context.Background(), b.chat, old.AdminChannel, "", "Failed to reload configuration, keeping the previous one: %v", err)
+		}
+		return err
+	}
+	if b.chat != nil {
+		// the bot is running, start the new plugin instances. They run
+		// until the bot stops, or until they are replaced.
+		if err := b.startPlugins(b.runCtx, c, c.Plugins); err != nil {
+			b.Log.Errorf("failed to reload configuration, keeping the previous one: %v", err)
+			if old.AdminChannel != "" {
+				actions.Say(context.Background(), b.chat, old.AdminChannel, "", "Failed to reload configuration, keeping the previous one: %v", err)
+			}
+			return err
+		}
+	}
+	b.config.Store(c)
+
+	var stale []*plugins.Instance
+	for _, p := range old.Plugins {
+		if c.plugin(p.Name()) != p {
+			stale = append(stale, p)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout())
+	defer cancel()
+	stopPlugins(ctx, stale, b.Log)
+	b.Log.Infof("Configuration reloaded, %d plugin(s) replaced", len(stale))
+	return nil
+}
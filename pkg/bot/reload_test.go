@@ -0,0 +1,213 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// lifecyclePlugin records the calls to its lifecycle methods. Its
+// configuration can make Load or Start fail.
+type lifecyclePlugin struct {
+	FailLoad  bool   `json:"fail_load"`
+	FailStart bool   `json:"fail_start"`
+	Command   string `json:"command"`
+
+	mu       sync.Mutex
+	svc      *plugins.Services
+	startCtx context.Context
+	started  bool
+	stopped  bool
+}
+
+// lifecycles records the lifecycle plugins created by the factory.
+var lifecycles struct {
+	sync.Mutex
+	all []*lifecyclePlugin
+}
+
+func init() {
+	if err := plugins.Register("lifecycle", func() plugins.Plugin {
+		p := &lifecyclePlugin{}
+		lifecycles.Lock()
+		lifecycles.all = append(lifecycles.all, p)
+		lifecycles.Unlock()
+		return p
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func (p *lifecyclePlugin) Name() string            { return "lifecycle" }
+func (p *lifecyclePlugin) Handles(cmd string) bool { return cmd == p.Command }
+
+func (p *lifecyclePlugin) Load(data []byte) error {
+	if err := json.Unmarshal(data, p); err != nil {
+		return err
+	}
+	if p.FailLoad {
+		return errors.New("load failed")
+	}
+	return nil
+}
+
+func (p *lifecyclePlugin) HandleCmd(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+	return nil
+}
+
+func (p *lifecyclePlugin) Init(svc *plugins.Services) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.svc = svc
+	return nil
+}
+
+func (p *lifecyclePlugin) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.FailStart {
+		return errors.New("start failed")
+	}
+	p.startCtx, p.started = ctx, true
+	return nil
+}
+
+func (p *lifecyclePlugin) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	return nil
+}
+
+// lifecyclePlugins returns the lifecycle plugins created so far, and forgets
+// them.
+func lifecyclePlugins() []*lifecyclePlugin {
+	lifecycles.Lock()
+	defer lifecycles.Unlock()
+	all := lifecycles.all
+	lifecycles.all = nil
+	return all
+}
+
+// reloadConfig returns an unvalidated configuration with the given
+// lifecycle plugin configurations, for Reload.
+func reloadConfig(prefix string, pconfs map[string]map[string]interface{}) *Config {
+	c := Config{CmdPrefix: prefix, PluginConfigs: make(map[string]interface{})}
+	for name, pconf := range pconfs {
+		c.PluginConfigs[name] = pconf
+	}
+	return &c
+}
+
+func TestReloadStartsWithRunContext(t *testing.T) {
+	srv := newServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	b := New(&Config{SlackAPIURL: srv.APIURL(), CmdPrefix: "."})
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Run(ctx)
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	defer stop()
+	if err := srv.WaitForConnection(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	lifecyclePlugins()
+
+	if err := b.Reload(reloadConfig(".", map[string]map[string]interface{}{"lifecycle": {"command": "one"}})); err != nil {
+		t.Fatal(err)
+	}
+	ps := lifecyclePlugins()
+	if len(ps) != 1 || !ps[0].started {
+		t.Fatalf("got plugins %+v, want one started plugin", ps)
+	}
+	if err := ps[0].startCtx.Err(); err != nil {
+		t.Errorf("the context of the started plugin is done after the reload: %v", err)
+	}
+	stop()
+	select {
+	case <-ps[0].startCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Errorf("the context of the started plugin is not done after the bot stopped")
+	}
+}
+
+func TestReloadFailure(t *testing.T) {
+	srv := newServer(t)
+	b := startBot(t, srv, &Config{CmdPrefix: "."})
+	lifecyclePlugins()
+
+	// Load fails: nothing is started nor stopped.
+	err := b.Reload(reloadConfig(".", map[string]map[string]interface{}{
+		"lifecycle/a": {"command": "a"},
+		"lifecycle/b": {"command": "b", "fail_load": true},
+	}))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, p := range lifecyclePlugins() {
+		if p.started || p.stopped {
+			t.Errorf("plugin %s was started or stopped after a load failure", p.Command)
+		}
+	}
+
+	// Start fails: only the started instances are stopped.
+	err = b.Reload(reloadConfig(".", map[string]map[string]interface{}{
+		"lifecycle/a": {"command": "a"},
+		"lifecycle/b": {"command": "b", "fail_start": true},
+		"lifecycle/c": {"command": "c"},
+	}))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, p := range lifecyclePlugins() {
+		if p.stopped != p.started {
+			t.Errorf("plugin %s: started %v, stopped %v", p.Command, p.started, p.stopped)
+		}
+	}
+	if n := len(b.Config().Plugins); n != 0 {
+		t.Errorf("got %d plugins after failed reloads, want the previous 0", n)
+	}
+}
+
+func TestReloadServices(t *testing.T) {
+	srv := newServer(t)
+	b := startBot(t, srv, &Config{CmdPrefix: "."})
+	lifecyclePlugins()
+
+	pconfs := map[string]map[string]interface{}{"lifecycle": {"command": "one"}}
+	if err := b.Reload(reloadConfig(".", pconfs)); err != nil {
+		t.Fatal(err)
+	}
+	first := lifecyclePlugins()
+	// unchanged: the instance is reused.
+	if err := b.Reload(reloadConfig(".", pconfs)); err != nil {
+		t.Fatal(err)
+	}
+	if ps := lifecyclePlugins(); len(ps) != 0 || first[0].stopped {
+		t.Errorf("the unchanged instance was not reused")
+	}
+	// the command prefix changed: a new instance gets the new services.
+	if err := b.Reload(reloadConfig("!", pconfs)); err != nil {
+		t.Fatal(err)
+	}
+	second := lifecyclePlugins()
+	if len(second) != 1 || second[0].svc == nil || second[0].svc.CmdPrefix != "!" {
+		t.Fatalf("got plugins %+v, want one with the new command prefix", second)
+	}
+	if !first[0].stopped {
+		t.Errorf("the previous instance was not stopped")
+	}
+}
@@ -0,0 +1,283 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Defaults of EditsConfig.
+var (
+	DefaultEditsMaxCommands = 1000
+	DefaultEditsWindow      = 24 * time.Hour
+)
+
+// EditsConfig configures the re-run of the commands whose message is edited.
+// The bot remembers the replies to the recent commands, and updates them in
+// place when the command message is edited, or deletes them when it is
+// deleted.
+type EditsConfig struct {
+	// MaxCommands is the maximum number of commands whose replies are
+	// remembered. The oldest ones are forgotten first.
+	MaxCommands int `mapstructure:"max_commands,omitempty"`
+	// Window is how long the replies to a command are remembered, e.g. "24h".
+	Window time.Duration `mapstructure:"window,omitempty"`
+}
+
+// Validate checks the configuration and sets the defaults.
+func (c *EditsConfig) Validate() error {
+	if c.MaxCommands < 0 {
+		return fmt.Errorf("max_commands cannot be negative")
+	}
+	if c.MaxCommands == 0 {
+		c.MaxCommands = DefaultEditsMaxCommands
+	}
+	if c.Window < 0 {
+		return fmt.Errorf("window cannot be negative")
+	}
+	if c.Window == 0 {
+		c.Window = DefaultEditsWindow
+	}
+	return nil
+}
+
+// replyTracker maps the command messages to the replies of the bot, keeping
+// at most a configured number of recent commands.
+type replyTracker struct {
+	mu      sync.Mutex
+	replies map[chat.MessageRef]trackedReplies
+	// order lists the commands from the oldest, including some that were
+	// forgotten already.
+	order []chat.MessageRef
+}
+
+type trackedReplies struct {
+	refs    []chat.MessageRef
+	expires time.Time
+}
+
+func newReplyTracker() *replyTracker {
+	return &replyTracker{replies: make(map[chat.MessageRef]trackedReplies)}
+}
+
+// get returns the replies to the command message cmd.
+func (t *replyTracker) get(cmd chat.MessageRef) []chat.MessageRef {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.replies[cmd]
+	if !ok || time.Now().After(r.expires) {
+		return nil
+	}
+	return r.refs
+}
+
+// set records the replies to the command message cmd, forgetting the oldest
+// commands if there are more than cfg.MaxCommands.
+func (t *replyTracker) set(cmd chat.MessageRef, refs []chat.MessageRef, cfg EditsConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.replies[cmd]; !ok {
+		t.order = append(t.order, cmd)
+	}
+	t.replies[cmd] = trackedReplies{refs: refs, expires: time.Now().Add(cfg.Window)}
+	for len(t.replies) > cfg.MaxCommands && len(t.order) > 0 {
+		delete(t.replies, t.order[0])
+		t.order = t.order[1:]
+	}
+	if len(t.order) > 2*cfg.MaxCommands {
+		// compact the commands that were forgotten already.
+		order := make([]chat.MessageRef, 0, len(t.replies))
+		for _, ref := range t.order {
+			if _, ok := t.replies[ref]; ok {
+				order = append(order, ref)
+			}
+		}
+		t.order = order
+	}
+}
+
+// take returns and forgets the replies to the command message cmd.
+func (t *replyTracker) take(cmd chat.MessageRef) []chat.MessageRef {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.replies[cmd]
+	delete(t.replies, cmd)
+	if !ok || time.Now().After(r.expires) {
+		return nil
+	}
+	return r.refs
+}
+
+// replyClient is a chat.Client that records the messages posted in the
+// channel of a command as its replies. If the command ran before, i.e. its
+// message was edited, the replies of the previous run are updated in place
+// instead of posting new messages, and those left over are deleted by
+// finish.
+type replyClient struct {
+	chat.Client
+	b   *Bot
+	cmd chat.MessageRef
+
+	mu       sync.Mutex
+	previous []chat.MessageRef
+	posted   []chat.MessageRef
+}
+
+// replyClient returns a client tracking the replies to the command message
+// msg. Messages without a timestamp, e.g. slash commands, are not tracked.
+func (b *Bot) replyClient(client chat.Client, msg *chat.Message) *replyClient {
+	if msg.Timestamp == "" {
+		return nil
+	}
+	return &replyClient{Client: client, b: b, cmd: msg.Ref()}
+}
+
+// start loads the replies of the previous run of the command. It must be
+// called when the command starts running, since the previous run, which is
+// dispatched on the same key, may still be posting its replies before that.
+func (c *replyClient) start() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.previous = c.b.replies.get(c.cmd)
+}
+
+func (c *replyClient) PostMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	ref, err := c.Post(ctx, &chat.OutgoingMessage{Channel: channel, ThreadTS: threadTS, Text: text})
+	return ref.Timestamp, err
+}
+
+func (c *replyClient) Post(ctx context.Context, msg *chat.OutgoingMessage) (chat.MessageRef, error) {
+	if msg.Channel != c.cmd.Channel {
+		return c.Client.Post(ctx, msg)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.previous) > 0 {
+		ref := c.previous[0]
+		c.previous = c.previous[1:]
+		err := c.Client.UpdateMessage(ctx, ref, msg)
+		if err == nil {
+			c.record(ref)
+			return ref, nil
+		}
+		logging.FromContext(ctx).Warnf("Failed to update the previous reply, posting a new one: %v", err)
+	}
+	ref, err := c.Client.Post(ctx, msg)
+	if err == nil {
+		c.record(ref)
+	}
+	return ref, err
+}
+
+// record adds ref to the replies. It must be called with c.mu held.
+func (c *replyClient) record(ref chat.MessageRef) {
+	c.posted = append(c.posted, ref)
+	cfg := c.b.Config().Edits
+	// errors are reported by Config.Validate, this sets the defaults.
+	_ = cfg.Validate()
+	c.b.replies.set(c.cmd, append([]chat.MessageRef(nil), c.posted...), cfg)
+}
+
+// finish deletes the replies of the previous run that were not replaced.
+func (c *replyClient) finish(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ref := range c.previous {
+		if err := c.Client.DeleteMessage(ctx, ref); err != nil {
+			logging.FromContext(ctx).Warnf("Failed to delete the previous reply: %v", err)
+		}
+	}
+	c.previous = nil
+	if len(c.posted) == 0 {
+		c.b.replies.take(c.cmd)
+	}
+}
+
+// handleEdit re-runs the command of an edited message, updating its previous
+// replies. If the message is not a command anymore, the replies are deleted.
+func (b *Bot) handleEdit(client chat.Client, ev *slackevents.MessageEvent) {
+	if ev.Message == nil {
+		return
+	}
+	msg := *ev.Message
+	msg.Channel, msg.ChannelType, msg.SubType = ev.Channel, ev.ChannelType, ""
+	if reason := b.ignoreMessage(msg.User, msg.BotID, ""); reason != "" {
+		b.metrics.ignoredEvents.Inc(reason)
+		return
+	}
+	if ev.PreviousMessage != nil && ev.PreviousMessage.Text == msg.Text {
+		// e.g. a link preview was added.
+		return
+	}
+	// the mentions are not sent again as app_mention events.
+	command, ok := b.parseCommand(&msg, true)
+	if !ok {
+		if b.wasCommand(ev) {
+			b.deleteReplies(client, chat.Message{Channel: msg.Channel, Timestamp: msg.TimeStamp, ThreadTimestamp: msg.ThreadTimeStamp})
+		}
+		return
+	}
+	b.Log.WithField("ts", msg.TimeStamp).Debugf("Command message edited, running it again")
+	b.dispatchCommand(client, command)
+}
+
+// handleDeletion deletes the replies to a deleted command message.
+func (b *Bot) handleDeletion(client chat.Client, ev *slackevents.MessageEvent) {
+	if !b.wasCommand(ev) {
+		return
+	}
+	b.deleteReplies(client, chat.Message{
+		Channel:         ev.Channel,
+		Timestamp:       ev.PreviousMessage.TimeStamp,
+		ThreadTimestamp: ev.PreviousMessage.ThreadTimeStamp,
+	})
+}
+
+// wasCommand returns true if the message before an edit or a deletion was a
+// command, whose replies may be tracked or still being posted.
+func (b *Bot) wasCommand(ev *slackevents.MessageEvent) bool {
+	if ev.PreviousMessage == nil {
+		return false
+	}
+	prev := *ev.PreviousMessage
+	prev.Channel, prev.ChannelType, prev.SubType = ev.Channel, ev.ChannelType, ""
+	if _, ok := b.parseCommand(&prev, true); ok {
+		return true
+	}
+	msg := messageFromEvent(&prev)
+	return b.replies.get(msg.Ref()) != nil
+}
+
+// deleteReplies deletes the replies to the command message msg, after the
+// commands running in its thread.
+func (b *Bot) deleteReplies(client chat.Client, msg chat.Message) {
+	log := b.Log.WithFields(logrus.Fields{"channel": msg.Channel, "ts": msg.Timestamp})
+	j := job{
+		run: func(ctx context.Context) {
+			for _, ref := range b.replies.take(msg.Ref()) {
+				if err := client.DeleteMessage(ctx, ref); err != nil {
+					log.Warnf("Failed to delete reply: %v", err)
+				}
+			}
+		},
+		onTimeout: func() {
+			log.Warnf("Deleting the replies timed out")
+		},
+		timeout: b.Config().CommandTimeout,
+	}
+	if !b.dispatcher.dispatch(threadKey(&msg), j) {
+		log.Warnf("Too many pending commands, not deleting the replies")
+	}
+}
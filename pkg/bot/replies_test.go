@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/actions"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/fakeslack"
+)
+
+// blockingPlugin replies with its argument, then waits for release before
+// returning.
+func blockingPlugin(release <-chan struct{}) *testPlugin {
+	return &testPlugin{name: "say", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		if err := actions.Say(ctx, client, cmd.Message.Channel, "", "%s", cmd.Arg); err != nil {
+			return err
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}}
+}
+
+// waitForPosts waits until the posts of srv satisfy ok.
+func waitForPosts(t *testing.T, srv *fakeslack.Server, ok func([]fakeslack.Post) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok(srv.Posts()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, got posts %+v", srv.Posts())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEditWhileRunning(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	release := make(chan struct{})
+	defer close(release)
+	startBot(t, srv, &Config{CommandTimeout: time.Minute}, blockingPlugin(release))
+
+	send(srv.SendEvent(messageEvent("C1", "U1", "1.1", ".say first")))
+	if p := expectPost(t, srv); p.Text != "first" {
+		t.Fatalf("got %q, want %q", p.Text, "first")
+	}
+	// the first run is still running when the message is edited.
+	send(srv.SendMessageChanged("C1", "1.1", "U1", ".say first", ".say second"))
+	release <- struct{}{}
+	waitForPosts(t, srv, func(posts []fakeslack.Post) bool {
+		return len(posts) == 1 && posts[0].Text == "second"
+	})
+	release <- struct{}{}
+	expectNoPost(t, srv)
+}
+
+func TestDeleteWhileRunning(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	release := make(chan struct{})
+	defer close(release)
+	startBot(t, srv, &Config{CommandTimeout: time.Minute}, blockingPlugin(release))
+
+	send(srv.SendEvent(messageEvent("C1", "U1", "1.1", ".say first")))
+	expectPost(t, srv)
+	// the reply is posted, but not tracked yet when the message is deleted.
+	send(srv.SendMessageDeleted("C1", "1.1", "U1", ".say first"))
+	release <- struct{}{}
+	waitForPosts(t, srv, func(posts []fakeslack.Post) bool {
+		return len(posts) == 0
+	})
+}
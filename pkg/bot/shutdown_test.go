@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/fakeslack"
+	"github.com/insomniacslk/slackbot/pkg/outbound"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// shutdownPlugin runs its command with handle, and records when it is
+// stopped.
+type shutdownPlugin struct {
+	testPlugin
+	svc     *plugins.Services
+	stopped atomic.Bool
+}
+
+func (p *shutdownPlugin) Init(svc *plugins.Services) error {
+	p.svc = svc
+	return nil
+}
+
+func (p *shutdownPlugin) Stop(ctx context.Context) error {
+	p.stopped.Store(true)
+	return nil
+}
+
+// runBot runs a bot connected to srv with the given plugin, and returns a
+// function that stops it and returns the error returned by Run.
+func runBot(t *testing.T, srv *fakeslack.Server, cfg *Config, p plugins.Plugin) func() error {
+	t.Helper()
+	cfg.SlackAPIURL, cfg.CmdPrefix = srv.APIURL(), "."
+	inst, err := plugins.NewInstance(p.Name(), p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Plugins = []*plugins.Instance{inst}
+	b := New(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Run(ctx)
+	}()
+	var once sync.Once
+	stop := func() error {
+		once.Do(cancel)
+		select {
+		case err := <-done:
+			done <- err
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatal("the bot did not stop")
+			return nil
+		}
+	}
+	t.Cleanup(func() { _ = stop() })
+	if err := srv.WaitForConnection(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return stop
+}
+
+func TestShutdownCompletesCommands(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	// slow deliveries, so that messages are pending at shutdown.
+	var (
+		mu    sync.Mutex
+		posts []string
+	)
+	srv.Handle("chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		posts = append(posts, r.FormValue("text"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "1.000001"}`))
+	})
+	started := make(chan struct{})
+	var completed atomic.Bool
+	p := &shutdownPlugin{}
+	p.testPlugin = testPlugin{name: "slow", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		for _, text := range []string{"one", "two", "three"} {
+			// queued, not waiting for the delivery.
+			if _, err := p.svc.Outbound.Send(outbound.Message{Channel: "C1", Text: text}); err != nil {
+				return err
+			}
+		}
+		completed.Store(true)
+		return nil
+	}}
+	stop := runBot(t, srv, &Config{ShutdownTimeout: 5 * time.Second}, p)
+
+	send(srv.SendMessage("C1", "U1", ".slow"))
+	<-started
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if !completed.Load() {
+		t.Errorf("the running command did not complete")
+	}
+	if !p.stopped.Load() {
+		t.Errorf("the plugin was not stopped")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posts) != 3 {
+		t.Errorf("got posts %q, want the 3 pending messages delivered", posts)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	started := make(chan struct{})
+	var cancelled atomic.Bool
+	p := &shutdownPlugin{}
+	p.testPlugin = testPlugin{name: "hang", handle: func(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+		close(started)
+		<-ctx.Done()
+		cancelled.Store(true)
+		return ctx.Err()
+	}}
+	stop := runBot(t, srv, &Config{ShutdownTimeout: 100 * time.Millisecond}, p)
+
+	send(srv.SendMessage("C1", "U1", ".hang"))
+	<-started
+	start := time.Now()
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("the bot stopped after %s, want about the shutdown timeout", d)
+	}
+	// the command is cancelled, but not waited for.
+	waitFor(t, cancelled.Load)
+	if !p.stopped.Load() {
+		t.Errorf("the plugin was not stopped")
+	}
+}
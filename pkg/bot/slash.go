@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/plugins"
+	"github.com/slack-go/slack"
+)
+
+// SlashCommand maps a Slack slash command to a plugin command.
+type SlashCommand struct {
+	// Command is the command line run by the slash command, without the
+	// command prefix, e.g. "oncall" or "oncall sre". The text typed after
+	// the slash command is appended to it.
+	Command string `mapstructure:"command"`
+	// Ephemeral makes all the responses visible only to the user who ran
+	// the slash command. Otherwise plugins choose: messages posted with
+	// PostEphemeral are only visible to the user, the others are shown in
+	// the channel.
+	Ephemeral bool `mapstructure:"ephemeral,omitempty"`
+}
+
+// validateSlashCommands checks the slash command mappings, adding the leading
+// `/` to their names if missing.
+func (c *Config) validateSlashCommands() error {
+	if len(c.SlashCommands) == 0 {
+		return nil
+	}
+	slash := make(map[string]SlashCommand, len(c.SlashCommands))
+	for name, sc := range c.SlashCommands {
+		if !strings.HasPrefix(name, "/") {
+			name = "/" + name
+		}
+		sc.Command = strings.TrimPrefix(strings.TrimSpace(sc.Command), c.CmdPrefix)
+		if sc.Command == "" {
+			return fmt.Errorf("slash command %s: missing command", name)
+		}
+		slash[name] = sc
+	}
+	c.SlashCommands = slash
+	return nil
+}
+
+// checkSlashCommands returns an error if a slash command is mapped to a
+// command that is neither built in nor handled by a plugin instance.
+func checkSlashCommands(slash map[string]SlashCommand, instances []*plugins.Instance) error {
+	for name, sc := range slash {
+		cmd, _ := splitCmd(sc.Command)
+		if cmd == HelpCmd {
+			continue
+		}
+		handled := false
+		for _, inst := range instances {
+			if inst.Handles(cmd) {
+				handled = true
+				break
+			}
+		}
+		if !handled {
+			return fmt.Errorf("slash command %s: no plugin handles the command %q", name, cmd)
+		}
+	}
+	return nil
+}
+
+// handleSlashCommand dispatches a slash command to the plugins, like a
+// command sent in a message. It must be acknowledged by the caller.
+func (b *Bot) handleSlashCommand(client chat.Client, sc slack.SlashCommand) {
+	cfg := b.Config()
+	mapping := cfg.SlashCommands[sc.Command]
+	name, arg := splitCmd(mapping.Command)
+	if sc.Text != "" {
+		arg = strings.TrimSpace(arg + " " + sc.Text)
+	}
+	command := chat.Command{
+		Name:        name,
+		Arg:         arg,
+		Slash:       sc.Command,
+		TriggerID:   sc.TriggerID,
+		ChannelType: slashChannelType(sc),
+		Message: chat.Message{
+			Channel: sc.ChannelID,
+			User:    sc.UserID,
+			Text:    strings.TrimSpace(sc.Command + " " + sc.Text),
+		},
+	}
+	b.dispatchCommand(b.slashClient(client, sc, mapping.Ephemeral), command)
+}
+
+// slashChannelType returns the type of the channel a slash command was
+// invoked in, or empty if unknown.
+func slashChannelType(sc slack.SlashCommand) string {
+	switch sc.ChannelName {
+	case "directmessage":
+		return chat.ChannelDirect
+	case "privategroup":
+		return chat.ChannelPrivate
+	}
+	return channelTypeFromID(sc.ChannelID)
+}
+
+// slashClient returns a chat.Client that sends the responses to a slash
+// command to its response URL.
+func (b *Bot) slashClient(client chat.Client, sc slack.SlashCommand, ephemeral bool) chat.Client {
+	return slashClient{
+		Client:     client,
+		httpClient: &http.Client{Timeout: DefaultHTTPTimeout},
+		m:          b.metrics,
+		cmd:        sc,
+		ephemeral:  ephemeral,
+	}
+}
+
+// slashClient is a chat.Client that sends the messages posted to the channel
+// of a slash command to its response URL, so that the bot does not need to
+// be a member of the channel. The other calls go through the embedded
+// client. A response has no timestamp, and is updated or deleted through
+// the response URL when referenced with an empty timestamp.
+type slashClient struct {
+	chat.Client
+	httpClient *http.Client
+	m          *botMetrics
+	cmd        slack.SlashCommand
+	ephemeral  bool
+}
+
+func (c slashClient) isResponse(channel, threadTS string) bool {
+	return channel == c.cmd.ChannelID && threadTS == ""
+}
+
+func (c slashClient) PostMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	ref, err := c.Post(ctx, &chat.OutgoingMessage{Channel: channel, ThreadTS: threadTS, Text: text})
+	return ref.Timestamp, err
+}
+
+func (c slashClient) Post(ctx context.Context, msg *chat.OutgoingMessage) (chat.MessageRef, error) {
+	if !c.isResponse(msg.Channel, msg.ThreadTS) {
+		return c.Client.Post(ctx, msg)
+	}
+	typ := slack.ResponseTypeInChannel
+	if c.ephemeral {
+		typ = slack.ResponseTypeEphemeral
+	}
+	if err := c.respond(ctx, webhookMessage(msg, typ)); err != nil {
+		return chat.MessageRef{}, err
+	}
+	return chat.MessageRef{Channel: msg.Channel}, nil
+}
+
+func (c slashClient) PostEphemeral(ctx context.Context, user string, msg *chat.OutgoingMessage) error {
+	if !c.isResponse(msg.Channel, msg.ThreadTS) || user != c.cmd.UserID {
+		return c.Client.PostEphemeral(ctx, user, msg)
+	}
+	return c.respond(ctx, webhookMessage(msg, slack.ResponseTypeEphemeral))
+}
+
+func (c slashClient) UpdateMessage(ctx context.Context, ref chat.MessageRef, msg *chat.OutgoingMessage) error {
+	if ref.Channel != c.cmd.ChannelID || ref.Timestamp != "" {
+		return c.Client.UpdateMessage(ctx, ref, msg)
+	}
+	wm := webhookMessage(msg, "")
+	wm.ReplaceOriginal = true
+	return c.respond(ctx, wm)
+}
+
+func (c slashClient) DeleteMessage(ctx context.Context, ref chat.MessageRef) error {
+	if ref.Channel != c.cmd.ChannelID || ref.Timestamp != "" {
+		return c.Client.DeleteMessage(ctx, ref)
+	}
+	return c.respond(ctx, &slack.WebhookMessage{DeleteOriginal: true})
+}
+
+func (c slashClient) respond(ctx context.Context, wm *slack.WebhookMessage) error {
+	err := slack.PostWebhookCustomHTTPContext(ctx, c.cmd.ResponseURL, c.httpClient, wm)
+	c.m.slackCalls.Inc("response_url")
+	if err != nil {
+		c.m.slackErrors.Inc("response_url")
+		return fmt.Errorf("failed to respond to %s: %w", c.cmd.Command, err)
+	}
+	return nil
+}
+
+func webhookMessage(msg *chat.OutgoingMessage, responseType string) *slack.WebhookMessage {
+	wm := slack.WebhookMessage{Text: msg.Text, ResponseType: responseType}
+	if len(msg.Blocks) > 0 {
+		wm.Blocks = &slack.Blocks{BlockSet: chat.SlackBlocks(msg.Blocks)}
+	}
+	return &wm
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlashCommand(t *testing.T) {
+	srv := newServer(t)
+	send := sender(t)
+	cfg := Config{SlashCommands: map[string]SlashCommand{"/echo": {Command: "echo"}}}
+	startBot(t, srv, &cfg, echoPlugin())
+
+	id := send(srv.SendSlashCommand("/echo", "C1", "U1", "hi"))
+	if _, err := srv.WaitForAck(id, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	p := expectPost(t, srv)
+	if p.Text != "echo: hi" || p.ResponseType != "in_channel" {
+		t.Errorf("got %q (%s), want %q in the channel", p.Text, p.ResponseType, "echo: hi")
+	}
+
+	id = send(srv.SendSlashCommand("/unknown", "C1", "U1", ""))
+	ack, err := srv.WaitForAck(id, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) == 0 {
+		t.Errorf("unknown slash command acknowledged without a message")
+	}
+	expectNoPost(t, srv)
+}
+
+func TestValidateSlashCommands(t *testing.T) {
+	for _, tc := range []struct {
+		slash map[string]SlashCommand
+		err   string
+	}{
+		{map[string]SlashCommand{"deploy": {Command: ".deploy prod"}}, ""},
+		{map[string]SlashCommand{"/help": {Command: "help"}}, ""},
+		{map[string]SlashCommand{"/deploy": {Command: " "}}, "missing command"},
+		{map[string]SlashCommand{"/oncall": {Command: "oncall"}}, `no plugin handles the command "oncall"`},
+	} {
+		cfg := reloadConfig(".", map[string]map[string]interface{}{"lifecycle": {"command": "deploy"}})
+		cfg.SlashCommands = tc.slash
+		err := cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%v: %v", tc.slash, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%v: got %v, want an error containing %q", tc.slash, err, tc.err)
+		}
+		if err != nil {
+			continue
+		}
+		// the leading / is added, and the command prefix removed.
+		for name, sc := range cfg.SlashCommands {
+			if !strings.HasPrefix(name, "/") || strings.HasPrefix(sc.Command, ".") {
+				t.Errorf("got slash command %s mapped to %q", name, sc.Command)
+			}
+		}
+	}
+}
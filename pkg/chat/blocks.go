@@ -0,0 +1,72 @@
+package chat
+
+// MessageRef identifies a message posted by the bot, so that it can be
+// updated, deleted or reacted to later.
+type MessageRef struct {
+	Channel   string
+	Timestamp string
+}
+
+// OutgoingMessage is a message to post, with optional layout blocks.
+type OutgoingMessage struct {
+	Channel string
+	// ThreadTS is the timestamp of the thread to reply to, or empty to post
+	// on the main channel.
+	ThreadTS string
+	// Text is the message text. If Blocks are set, it is only shown in
+	// notifications and by clients that cannot render the blocks.
+	Text   string
+	Blocks []Block
+}
+
+// Block is a layout block of a message. It is one of SectionBlock,
+// ContextBlock, DividerBlock, ActionsBlock and InputBlock. Input blocks are
+// only allowed in modal views.
+type Block interface {
+	isBlock()
+}
+
+// SectionBlock is a block of mrkdwn text, with optional fields shown in two
+// columns and an optional button on its side.
+type SectionBlock struct {
+	Text      string
+	Fields    []string
+	Accessory *Button
+}
+
+// ContextBlock is a block of small, secondary mrkdwn text elements.
+type ContextBlock struct {
+	Elements []string
+}
+
+// DividerBlock is a horizontal separator.
+type DividerBlock struct{}
+
+// ActionsBlock is a row of buttons, followed by menus.
+type ActionsBlock struct {
+	Buttons []Button
+	Menus   []Menu
+}
+
+func (SectionBlock) isBlock() {}
+func (ContextBlock) isBlock() {}
+func (DividerBlock) isBlock() {}
+func (ActionsBlock) isBlock() {}
+
+// Button styles.
+const (
+	ButtonDefault = ""
+	ButtonPrimary = "primary"
+	ButtonDanger  = "danger"
+)
+
+// Button is an interactive button. Buttons with a URL open it in the browser.
+type Button struct {
+	// ActionID identifies the button in the interaction callbacks.
+	ActionID string
+	Text     string
+	Value    string
+	URL      string
+	// Style is one of ButtonDefault, ButtonPrimary and ButtonDanger.
+	Style string
+}
@@ -0,0 +1,111 @@
+// Package chat defines the interface and types that the bot exposes to plugins
+// to talk to the chat service, independently of the underlying transport.
+package chat
+
+import (
+	"context"
+
+	"github.com/insomniacslk/slackbot/pkg/bot/cmdline"
+)
+
+// Client is the interface that plugins use to interact with the chat service.
+// The bot provides a Slack-backed implementation, see NewSlackClient, and the
+// chattest package provides an in-memory one for tests.
+type Client interface {
+	// PostMessage posts a message to a channel. If threadTS is not empty the
+	// message is posted as a reply in that thread, otherwise on the main
+	// channel. It returns the timestamp of the posted message.
+	PostMessage(ctx context.Context, channel, threadTS, text string) (string, error)
+	// Post posts a message with optional layout blocks, and returns a
+	// reference to it.
+	Post(ctx context.Context, msg *OutgoingMessage) (MessageRef, error)
+	// PostEphemeral posts a message that is only visible to the given user.
+	// Ephemeral messages cannot be updated or deleted.
+	PostEphemeral(ctx context.Context, user string, msg *OutgoingMessage) error
+	// UpdateMessage replaces the text and the blocks of a message previously
+	// posted by the bot. The channel and thread of msg are ignored.
+	UpdateMessage(ctx context.Context, ref MessageRef, msg *OutgoingMessage) error
+	// DeleteMessage deletes a message previously posted by the bot.
+	DeleteMessage(ctx context.Context, ref MessageRef) error
+	// GetUserByEmail looks up a user by their e-mail address.
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// AddReaction adds an emoji reaction to the message identified by channel
+	// and timestamp.
+	AddReaction(ctx context.Context, channel, ts, name string) error
+	// RemoveReaction removes an emoji reaction from the message identified by
+	// channel and timestamp.
+	RemoveReaction(ctx context.Context, channel, ts, name string) error
+	// OpenView opens a modal view in response to the interaction or the
+	// command identified by triggerID, and returns the view ID.
+	OpenView(ctx context.Context, triggerID string, view *View) (string, error)
+	// PushView pushes a modal view on top of the open one, and returns the
+	// view ID.
+	PushView(ctx context.Context, triggerID string, view *View) (string, error)
+	// UpdateView replaces an open modal view.
+	UpdateView(ctx context.Context, viewID string, view *View) error
+	// GetUserGroupMembers returns the IDs of the members of the user group
+	// with the given handle, e.g. "sre" for @sre.
+	GetUserGroupMembers(ctx context.Context, handle string) ([]string, error)
+}
+
+// User is a chat user.
+type User struct {
+	ID       string
+	Name     string
+	RealName string
+	Email    string
+}
+
+// Message is a message received from the chat service.
+type Message struct {
+	Channel         string
+	User            string
+	Text            string
+	Timestamp       string
+	ThreadTimestamp string
+}
+
+// Ref returns a reference to the message, e.g. to react to it.
+func (m *Message) Ref() MessageRef {
+	return MessageRef{Channel: m.Channel, Timestamp: m.Timestamp}
+}
+
+// Command is a command invocation received by the bot and handed to plugins.
+type Command struct {
+	// Name is the command name, without the command prefix.
+	Name string
+	// Arg is the rest of the command line, with leading and trailing spaces
+	// removed. Plugins that need boolean flags before positional arguments
+	// can parse it again with cmdline.ParseLine.
+	Arg string
+	// Args holds the parsed arguments and flags of the command.
+	Args *cmdline.Args
+	// Message is the message that contained the command. For slash
+	// commands, it has no timestamp.
+	Message Message
+	// Slash is the slash command that invoked the command, e.g. "/oncall",
+	// or empty if it was invoked by a message.
+	Slash string
+	// TriggerID can be used to open a modal view in response to a slash
+	// command.
+	TriggerID string
+	// Mention is true if the command was invoked by mentioning the bot, e.g.
+	// "@bot oncall sre".
+	Mention bool
+	// ChannelType is the type of the channel the command was invoked in, one
+	// of ChannelPublic, ChannelPrivate, ChannelDirect and ChannelGroup, or
+	// empty if unknown.
+	ChannelType string
+}
+
+// Channel types, see Command.ChannelType.
+const (
+	// ChannelPublic is a public channel.
+	ChannelPublic = "channel"
+	// ChannelPrivate is a private channel.
+	ChannelPrivate = "group"
+	// ChannelDirect is a direct message conversation with the bot.
+	ChannelDirect = "im"
+	// ChannelGroup is a direct message conversation between multiple users.
+	ChannelGroup = "mpim"
+)
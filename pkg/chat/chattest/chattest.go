@@ -0,0 +1,248 @@
+// Package chattest provides an in-memory implementation of chat.Client, for
+// use in plugin tests.
+package chattest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+)
+
+// Post is a message posted through the Client.
+type Post struct {
+	Channel   string
+	ThreadTS  string
+	Text      string
+	Blocks    []chat.Block
+	Timestamp string
+	// Ephemeral is the user an ephemeral message was shown to, empty for
+	// regular messages.
+	Ephemeral string
+	// Edited is true if the message was updated after being posted.
+	Edited bool
+}
+
+// View is a modal view opened through the Client.
+type View struct {
+	ID string
+	// TriggerID is the trigger ID the view was opened or pushed with.
+	TriggerID string
+	View      chat.View
+	// Updates is the number of times the view was updated.
+	Updates int
+}
+
+// Reaction is a reaction added through the Client.
+type Reaction struct {
+	Channel   string
+	Timestamp string
+	Name      string
+}
+
+// Client is an in-memory chat.Client that records everything that plugins
+// send through it. The zero value is ready to use.
+type Client struct {
+	mu        sync.Mutex
+	posts     []Post
+	reactions []Reaction
+	views     []View
+	users     map[string]*chat.User
+	groups    map[string][]string
+	seq       int
+}
+
+var _ chat.Client = (*Client)(nil)
+
+// NewClient returns a new in-memory client.
+func NewClient() *Client {
+	return &Client{}
+}
+
+// AddUser makes a user available to GetUserByEmail.
+func (c *Client) AddUser(u chat.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.users == nil {
+		c.users = make(map[string]*chat.User)
+	}
+	c.users[u.Email] = &u
+}
+
+// AddUserGroup makes a user group available to GetUserGroupMembers.
+func (c *Client) AddUserGroup(handle string, members ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.groups == nil {
+		c.groups = make(map[string][]string)
+	}
+	c.groups[handle] = append([]string(nil), members...)
+}
+
+// Posts returns a copy of the messages posted so far, in their current
+// state. Deleted messages are not returned.
+func (c *Client) Posts() []Post {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Post(nil), c.posts...)
+}
+
+// Views returns a copy of the modal views opened so far, in their current
+// state.
+func (c *Client) Views() []View {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]View(nil), c.views...)
+}
+
+// Reactions returns a copy of the reactions currently set.
+func (c *Client) Reactions() []Reaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Reaction(nil), c.reactions...)
+}
+
+// PostMessage implements chat.Client.PostMessage.
+func (c *Client) PostMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	ref, err := c.Post(ctx, &chat.OutgoingMessage{Channel: channel, ThreadTS: threadTS, Text: text})
+	return ref.Timestamp, err
+}
+
+// Post implements chat.Client.Post.
+func (c *Client) Post(ctx context.Context, msg *chat.OutgoingMessage) (chat.MessageRef, error) {
+	ts := c.add(msg, "")
+	return chat.MessageRef{Channel: msg.Channel, Timestamp: ts}, nil
+}
+
+// PostEphemeral implements chat.Client.PostEphemeral.
+func (c *Client) PostEphemeral(ctx context.Context, user string, msg *chat.OutgoingMessage) error {
+	c.add(msg, user)
+	return nil
+}
+
+func (c *Client) add(msg *chat.OutgoingMessage, ephemeral string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	ts := fmt.Sprintf("%d.000000", c.seq)
+	c.posts = append(c.posts, Post{
+		Channel:   msg.Channel,
+		ThreadTS:  msg.ThreadTS,
+		Text:      msg.Text,
+		Blocks:    append([]chat.Block(nil), msg.Blocks...),
+		Timestamp: ts,
+		Ephemeral: ephemeral,
+	})
+	return ts
+}
+
+// find returns the index of a posted message, or -1. Must be called with mu
+// held.
+func (c *Client) find(ref chat.MessageRef) int {
+	for i, p := range c.posts {
+		if p.Channel == ref.Channel && p.Timestamp == ref.Timestamp && p.Ephemeral == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// UpdateMessage implements chat.Client.UpdateMessage.
+func (c *Client) UpdateMessage(ctx context.Context, ref chat.MessageRef, msg *chat.OutgoingMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.find(ref)
+	if i < 0 {
+		return fmt.Errorf("message_not_found")
+	}
+	c.posts[i].Text = msg.Text
+	c.posts[i].Blocks = append([]chat.Block(nil), msg.Blocks...)
+	c.posts[i].Edited = true
+	return nil
+}
+
+// DeleteMessage implements chat.Client.DeleteMessage.
+func (c *Client) DeleteMessage(ctx context.Context, ref chat.MessageRef) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.find(ref)
+	if i < 0 {
+		return fmt.Errorf("message_not_found")
+	}
+	c.posts = append(c.posts[:i], c.posts[i+1:]...)
+	return nil
+}
+
+// OpenView implements chat.Client.OpenView.
+func (c *Client) OpenView(ctx context.Context, triggerID string, view *chat.View) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	id := fmt.Sprintf("V%06d", c.seq)
+	c.views = append(c.views, View{ID: id, TriggerID: triggerID, View: *view})
+	return id, nil
+}
+
+// PushView implements chat.Client.PushView.
+func (c *Client) PushView(ctx context.Context, triggerID string, view *chat.View) (string, error) {
+	return c.OpenView(ctx, triggerID, view)
+}
+
+// UpdateView implements chat.Client.UpdateView.
+func (c *Client) UpdateView(ctx context.Context, viewID string, view *chat.View) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, v := range c.views {
+		if v.ID == viewID {
+			c.views[i].View = *view
+			c.views[i].Updates++
+			return nil
+		}
+	}
+	return fmt.Errorf("not_found")
+}
+
+// GetUserByEmail implements chat.Client.GetUserByEmail.
+func (c *Client) GetUserByEmail(ctx context.Context, email string) (*chat.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[email]
+	if !ok {
+		return nil, fmt.Errorf("users_not_found")
+	}
+	uc := *u
+	return &uc, nil
+}
+
+// AddReaction implements chat.Client.AddReaction.
+func (c *Client) AddReaction(ctx context.Context, channel, ts, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reactions = append(c.reactions, Reaction{Channel: channel, Timestamp: ts, Name: name})
+	return nil
+}
+
+// RemoveReaction implements chat.Client.RemoveReaction.
+func (c *Client) RemoveReaction(ctx context.Context, channel, ts, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, r := range c.reactions {
+		if r.Channel == channel && r.Timestamp == ts && r.Name == name {
+			c.reactions = append(c.reactions[:i], c.reactions[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no_reaction")
+}
+
+// GetUserGroupMembers implements chat.Client.GetUserGroupMembers.
+func (c *Client) GetUserGroupMembers(ctx context.Context, handle string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	members, ok := c.groups[handle]
+	if !ok {
+		return nil, fmt.Errorf("user group %q not found", handle)
+	}
+	return append([]string(nil), members...), nil
+}
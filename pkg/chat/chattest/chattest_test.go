@@ -0,0 +1,109 @@
+package chattest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+)
+
+func TestMessages(t *testing.T) {
+	ctx := context.Background()
+	var c Client
+	ts, err := c.PostMessage(ctx, "C1", "1.1", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := c.Post(ctx, &chat.OutgoingMessage{Channel: "C1", Text: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PostEphemeral(ctx, "U1", &chat.OutgoingMessage{Channel: "C1", Text: "only you"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateMessage(ctx, chat.MessageRef{Channel: "C1", Timestamp: ts}, &chat.OutgoingMessage{Text: "hello again"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteMessage(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	posts := c.Posts()
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts, want 2", len(posts))
+	}
+	if p := posts[0]; p.Text != "hello again" || !p.Edited || p.ThreadTS != "1.1" || p.Timestamp != ts {
+		t.Errorf("got %+v, want the edited message", p)
+	}
+	if p := posts[1]; p.Ephemeral != "U1" || p.Text != "only you" {
+		t.Errorf("got %+v, want the ephemeral message", p)
+	}
+	// ephemeral and deleted messages cannot be updated or deleted.
+	if err := c.UpdateMessage(ctx, chat.MessageRef{Channel: "C1", Timestamp: posts[1].Timestamp}, &chat.OutgoingMessage{}); err == nil {
+		t.Errorf("updated an ephemeral message")
+	}
+	if err := c.DeleteMessage(ctx, ref); err == nil {
+		t.Errorf("deleted a message twice")
+	}
+}
+
+func TestViews(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	id, err := c.OpenView(ctx, "trigger-1", &chat.View{Title: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PushView(ctx, "trigger-2", &chat.View{Title: "two"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateView(ctx, id, &chat.View{Title: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateView(ctx, "VMISSING", &chat.View{}); err == nil {
+		t.Errorf("updated a missing view")
+	}
+	views := c.Views()
+	if len(views) != 2 || views[0].View.Title != "updated" || views[0].Updates != 1 || views[1].TriggerID != "trigger-2" {
+		t.Errorf("got views %+v", views)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	for _, name := range []string{"eyes", "white_check_mark"} {
+		if err := c.AddReaction(ctx, "C1", "1.1", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.RemoveReaction(ctx, "C1", "1.1", "eyes"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveReaction(ctx, "C1", "1.1", "eyes"); err == nil {
+		t.Errorf("removed a reaction twice")
+	}
+	if r := c.Reactions(); len(r) != 1 || r[0].Name != "white_check_mark" {
+		t.Errorf("got reactions %+v", r)
+	}
+}
+
+func TestUsersAndGroups(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	c.AddUser(chat.User{ID: "U1", Email: "a@example.com"})
+	c.AddUserGroup("sre", "U1", "U2")
+	u, err := c.GetUserByEmail(ctx, "a@example.com")
+	if err != nil || u.ID != "U1" {
+		t.Errorf("GetUserByEmail = %+v, %v, want U1", u, err)
+	}
+	if _, err := c.GetUserByEmail(ctx, "b@example.com"); err == nil {
+		t.Errorf("found an unknown user")
+	}
+	members, err := c.GetUserGroupMembers(ctx, "sre")
+	if err != nil || len(members) != 2 {
+		t.Errorf("GetUserGroupMembers = %v, %v, want 2 members", members, err)
+	}
+	if _, err := c.GetUserGroupMembers(ctx, "web"); err == nil {
+		t.Errorf("found an unknown user group")
+	}
+}
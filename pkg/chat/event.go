@@ -0,0 +1,48 @@
+package chat
+
+// Event types commonly subscribed to by plugins, see Event. Plugins can
+// subscribe to any other Events API type by name.
+const (
+	EventReactionAdded       = "reaction_added"
+	EventReactionRemoved     = "reaction_removed"
+	EventMemberJoinedChannel = "member_joined_channel"
+	EventMemberLeftChannel   = "member_left_channel"
+	EventChannelCreated      = "channel_created"
+)
+
+// Event is an event received from the chat service, other than a command.
+// The fields that do not apply to the event type are empty.
+type Event struct {
+	// Type is the event type, e.g. EventReactionAdded.
+	Type string
+	// User is the user who caused the event, e.g. who reacted, joined the
+	// channel or created it.
+	User string
+	// Channel is the channel the event happened in, or the channel created.
+	Channel string
+	// Name is the name of the channel created.
+	Name string
+	// Inviter is the user who invited User to the channel, if any.
+	Inviter string
+	// Reaction is the name of the emoji added or removed, without colons.
+	Reaction string
+	// Item is the message reacted to, and ItemUser its author.
+	Item     MessageRef
+	ItemUser string
+	// Raw is the event payload, in the JSON format of the chat service, for
+	// the fields not exposed above.
+	Raw []byte
+}
+
+// Match is a message matched by the patterns of a message listener.
+type Match struct {
+	Message Message
+	// ChannelType is the type of the channel of the message, see
+	// Command.ChannelType.
+	ChannelType string
+	// Matches holds, for each pattern of the listener, the successive
+	// matches in the message text as returned by
+	// regexp.Regexp.FindAllStringSubmatch, or nil if the pattern did not
+	// match.
+	Matches [][][]string
+}
@@ -0,0 +1,139 @@
+package chat
+
+import (
+	"sort"
+	"strings"
+)
+
+// Option is an option of a menu.
+type Option struct {
+	Text  string
+	Value string
+}
+
+// Menu is a drop-down menu of static options.
+type Menu struct {
+	// ActionID identifies the menu in the interaction callbacks.
+	ActionID    string
+	Placeholder string
+	Options     []Option
+	// Initial is the value of the option initially selected, if any.
+	Initial string
+}
+
+// InputBlock is a labelled input field of a modal view. It is a menu if
+// Options are set, otherwise a text field.
+type InputBlock struct {
+	// ActionID identifies the input in Interaction.Values.
+	ActionID    string
+	Label       string
+	Placeholder string
+	Hint        string
+	// Initial is the initial text, or the value of the initially selected
+	// option.
+	Initial   string
+	Multiline bool
+	Optional  bool
+	Options   []Option
+}
+
+func (InputBlock) isBlock() {}
+
+// View is a modal view.
+type View struct {
+	// CallbackID identifies the view in the interaction callbacks. It must
+	// be namespaced like the action IDs, see Interaction.
+	CallbackID string
+	Title      string
+	// Submit and Close are the labels of the buttons. A view without a
+	// Submit label cannot be submitted.
+	Submit string
+	Close  string
+	Blocks []Block
+	// NotifyOnClose requests an InteractionViewClosed callback when the
+	// user closes the view without submitting it.
+	NotifyOnClose bool
+	// State is opaque plugin data attached to the view, which is passed back
+	// in Interaction.State. It is kept by the bot, not sent to the chat
+	// service, and survives restarts of the bot.
+	State []byte
+}
+
+// Interaction types.
+const (
+	// InteractionBlockAction is a click on a button or a menu selection.
+	InteractionBlockAction = "block_action"
+	// InteractionViewSubmission is the submission of a modal view.
+	InteractionViewSubmission = "view_submission"
+	// InteractionViewClosed is the dismissal of a modal view.
+	InteractionViewClosed = "view_closed"
+)
+
+// ActionSeparator separates the namespace of an action or callback ID, i.e.
+// the plugin instance name, from the plugin's own ID.
+const ActionSeparator = ":"
+
+// SplitActionID splits a namespaced action or callback ID in the namespace
+// and the plugin's own ID. The namespace is empty if the ID is not
+// namespaced.
+func SplitActionID(id string) (string, string) {
+	ns, local, ok := strings.Cut(id, ActionSeparator)
+	if !ok {
+		return "", id
+	}
+	return ns, local
+}
+
+// Interaction is a user interaction with the blocks or the modal views
+// posted by a plugin. Plugins attach their instance name as the namespace of
+// the action IDs and callback IDs, see plugins.Services.ActionID, and the
+// bot routes the interactions to the plugin accordingly.
+type Interaction struct {
+	// Type is one of InteractionBlockAction, InteractionViewSubmission and
+	// InteractionViewClosed.
+	Type string
+	// ActionID is the ID of the button or menu for block actions, or the
+	// callback ID of the view for view interactions, without the namespace.
+	ActionID string
+	// Value is the value of the button, or of the selected option.
+	Value string
+	// User is the ID of the user who interacted.
+	User string
+	// Channel is the channel of the message containing the blocks, or of
+	// the message or command that opened the view, if known.
+	Channel string
+	// Message is the message containing the blocks, or that opened the
+	// view, if any. Its text is the text of the message posted by the bot.
+	Message *Message
+	// TriggerID can be used to open a modal view in response.
+	TriggerID string
+	// ViewID is the ID of the view the interaction happened in, if any.
+	ViewID string
+	// Values are the values of the inputs of a submitted view, by action
+	// ID. Menus have the values of the selected options.
+	Values map[string][]string
+	// State is the data attached to the view, see View.State.
+	State []byte
+}
+
+// ValueOf returns the first value of an input of a submitted view.
+func (i *Interaction) ValueOf(actionID string) string {
+	if v := i.Values[actionID]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// ViewErrors are validation errors of a submitted view, by input action ID.
+// Plugins return them from HandleInteraction to show the errors next to
+// the inputs, instead of closing the view.
+type ViewErrors map[string]string
+
+func (e ViewErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for id, msg := range e {
+		fields = append(fields, id+": "+msg)
+	}
+	sort.Strings(fields)
+	return "invalid input: " + strings.Join(fields, ", ")
+}
@@ -0,0 +1,244 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// NewSlackClient returns a Client backed by the Slack web API.
+func NewSlackClient(api *slack.Client) Client {
+	return &slackClient{api: api}
+}
+
+type slackClient struct {
+	api *slack.Client
+}
+
+func (c *slackClient) PostMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	_, ts, err := c.api.PostMessageContext(
+		ctx,
+		channel,
+		slack.MsgOptionText(text, false),
+		// if threadTS is an empty string, the message is posted on the main channel/thread
+		slack.MsgOptionTS(threadTS),
+	)
+	return ts, err
+}
+
+func (c *slackClient) Post(ctx context.Context, msg *OutgoingMessage) (MessageRef, error) {
+	channel, ts, err := c.api.PostMessageContext(
+		ctx,
+		msg.Channel,
+		slack.MsgOptionText(msg.Text, false),
+		slack.MsgOptionBlocks(SlackBlocks(msg.Blocks)...),
+		slack.MsgOptionTS(msg.ThreadTS),
+	)
+	if err != nil {
+		return MessageRef{}, err
+	}
+	return MessageRef{Channel: channel, Timestamp: ts}, nil
+}
+
+func (c *slackClient) PostEphemeral(ctx context.Context, user string, msg *OutgoingMessage) error {
+	_, err := c.api.PostEphemeralContext(
+		ctx,
+		msg.Channel,
+		user,
+		slack.MsgOptionText(msg.Text, false),
+		slack.MsgOptionBlocks(SlackBlocks(msg.Blocks)...),
+		slack.MsgOptionTS(msg.ThreadTS),
+	)
+	return err
+}
+
+func (c *slackClient) UpdateMessage(ctx context.Context, ref MessageRef, msg *OutgoingMessage) error {
+	// always send the blocks, even if empty, otherwise Slack keeps the
+	// previous ones.
+	blocks := append([]slack.Block{}, SlackBlocks(msg.Blocks)...)
+	_, _, _, err := c.api.UpdateMessageContext(
+		ctx,
+		ref.Channel,
+		ref.Timestamp,
+		slack.MsgOptionText(msg.Text, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	return err
+}
+
+func (c *slackClient) DeleteMessage(ctx context.Context, ref MessageRef) error {
+	_, _, err := c.api.DeleteMessageContext(ctx, ref.Channel, ref.Timestamp)
+	return err
+}
+
+func (c *slackClient) OpenView(ctx context.Context, triggerID string, view *View) (string, error) {
+	resp, err := c.api.OpenViewContext(ctx, triggerID, modalView(view))
+	if err != nil {
+		return "", viewError(resp, err)
+	}
+	return resp.ID, nil
+}
+
+func (c *slackClient) PushView(ctx context.Context, triggerID string, view *View) (string, error) {
+	resp, err := c.api.PushViewContext(ctx, triggerID, modalView(view))
+	if err != nil {
+		return "", viewError(resp, err)
+	}
+	return resp.ID, nil
+}
+
+func (c *slackClient) UpdateView(ctx context.Context, viewID string, view *View) error {
+	resp, err := c.api.UpdateViewContext(ctx, modalView(view), "", "", viewID)
+	if err != nil {
+		return viewError(resp, err)
+	}
+	return nil
+}
+
+// viewError adds the details returned by Slack to the error of a views
+// call, e.g. which block is invalid.
+func viewError(resp *slack.ViewResponse, err error) error {
+	if resp != nil && len(resp.ResponseMetadata.Messages) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.Join(resp.ResponseMetadata.Messages, "; "))
+	}
+	return err
+}
+
+func (c *slackClient) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	u, err := c.api.GetUserByEmailContext(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:       u.ID,
+		Name:     u.Name,
+		RealName: u.RealName,
+		Email:    u.Profile.Email,
+	}, nil
+}
+
+func (c *slackClient) AddReaction(ctx context.Context, channel, ts, name string) error {
+	return c.api.AddReactionContext(ctx, name, slack.NewRefToMessage(channel, ts))
+}
+
+func (c *slackClient) RemoveReaction(ctx context.Context, channel, ts, name string) error {
+	return c.api.RemoveReactionContext(ctx, name, slack.NewRefToMessage(channel, ts))
+}
+
+func (c *slackClient) GetUserGroupMembers(ctx context.Context, handle string) ([]string, error) {
+	groups, err := c.api.GetUserGroupsContext(ctx, slack.GetUserGroupsOptionIncludeUsers(true))
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Handle == handle {
+			return g.Users, nil
+		}
+	}
+	return nil, fmt.Errorf("user group %q not found", handle)
+}
+
+// SlackBlocks converts the layout blocks to Slack Block Kit blocks.
+func SlackBlocks(blocks []Block) []slack.Block {
+	var sb []slack.Block
+	for _, b := range blocks {
+		switch b := b.(type) {
+		case SectionBlock:
+			var text *slack.TextBlockObject
+			if b.Text != "" {
+				text = mrkdwn(b.Text)
+			}
+			var fields []*slack.TextBlockObject
+			for _, f := range b.Fields {
+				fields = append(fields, mrkdwn(f))
+			}
+			var accessory *slack.Accessory
+			if b.Accessory != nil {
+				accessory = slack.NewAccessory(slackButton(*b.Accessory))
+			}
+			sb = append(sb, slack.NewSectionBlock(text, fields, accessory))
+		case ContextBlock:
+			var elements []slack.MixedElement
+			for _, e := range b.Elements {
+				elements = append(elements, mrkdwn(e))
+			}
+			sb = append(sb, slack.NewContextBlock("", elements...))
+		case DividerBlock:
+			sb = append(sb, slack.NewDividerBlock())
+		case ActionsBlock:
+			var elements []slack.BlockElement
+			for _, btn := range b.Buttons {
+				elements = append(elements, slackButton(btn))
+			}
+			for _, m := range b.Menus {
+				elements = append(elements, slackMenu(m.ActionID, m.Placeholder, m.Options, m.Initial))
+			}
+			sb = append(sb, slack.NewActionBlock("", elements...))
+		case InputBlock:
+			var element slack.BlockElement
+			if len(b.Options) > 0 {
+				element = slackMenu(b.ActionID, b.Placeholder, b.Options, b.Initial)
+			} else {
+				input := slack.NewPlainTextInputBlockElement(plainText(b.Placeholder), b.ActionID)
+				input.InitialValue = b.Initial
+				input.Multiline = b.Multiline
+				element = input
+			}
+			// the block ID is the action ID, so that ViewErrors can be
+			// keyed by action ID.
+			input := slack.NewInputBlock(b.ActionID, plainText(b.Label), element)
+			input.Hint = plainText(b.Hint)
+			input.Optional = b.Optional
+			sb = append(sb, input)
+		}
+	}
+	return sb
+}
+
+func mrkdwn(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+// plainText returns a plain text object, or nil if text is empty.
+func plainText(text string) *slack.TextBlockObject {
+	if text == "" {
+		return nil
+	}
+	return slack.NewTextBlockObject(slack.PlainTextType, text, true, false)
+}
+
+func slackMenu(actionID, placeholder string, options []Option, initial string) *slack.SelectBlockElement {
+	var opts []*slack.OptionBlockObject
+	var initialOption *slack.OptionBlockObject
+	for _, o := range options {
+		opt := slack.NewOptionBlockObject(o.Value, plainText(o.Text), nil)
+		if o.Value == initial && initial != "" {
+			initialOption = opt
+		}
+		opts = append(opts, opt)
+	}
+	menu := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plainText(placeholder), actionID, opts...)
+	menu.InitialOption = initialOption
+	return menu
+}
+
+// modalView converts a View to a Slack modal view request.
+func modalView(v *View) slack.ModalViewRequest {
+	return slack.ModalViewRequest{
+		Type:          slack.VTModal,
+		Title:         plainText(v.Title),
+		Submit:        plainText(v.Submit),
+		Close:         plainText(v.Close),
+		Blocks:        slack.Blocks{BlockSet: SlackBlocks(v.Blocks)},
+		CallbackID:    v.CallbackID,
+		NotifyOnClose: v.NotifyOnClose,
+	}
+}
+
+func slackButton(b Button) *slack.ButtonBlockElement {
+	btn := slack.NewButtonBlockElement(b.ActionID, b.Value, plainText(b.Text))
+	btn.URL = b.URL
+	return btn.WithStyle(slack.Style(b.Style))
+}
@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSlackBlocks(t *testing.T) {
+	blocks := []Block{
+		SectionBlock{
+			Text:      "*Oncall*",
+			Fields:    []string{"*Current*\n<@U1>", "*Until*\nJan 02"},
+			Accessory: &Button{ActionID: "oncall/page", Text: "Page", Value: "U1", Style: ButtonDanger},
+		},
+		DividerBlock{},
+		ContextBlock{Elements: []string{"Updated every hour"}},
+		ActionsBlock{Buttons: []Button{{Text: "Runbook", URL: "https://example.com/runbook"}}},
+	}
+	want := `[
+		{"type": "section",
+		 "text": {"type": "mrkdwn", "text": "*Oncall*"},
+		 "fields": [
+			{"type": "mrkdwn", "text": "*Current*\n<@U1>"},
+			{"type": "mrkdwn", "text": "*Until*\nJan 02"}
+		 ],
+		 "accessory": {
+			"type": "button",
+			"text": {"type": "plain_text", "text": "Page", "emoji": true},
+			"action_id": "oncall/page",
+			"value": "U1",
+			"style": "danger"
+		 }},
+		{"type": "divider"},
+		{"type": "context", "elements": [{"type": "mrkdwn", "text": "Updated every hour"}]},
+		{"type": "actions", "elements": [
+			{"type": "button",
+			 "text": {"type": "plain_text", "text": "Runbook", "emoji": true},
+			 "url": "https://example.com/runbook"}
+		]}
+	]`
+	data, err := json.Marshal(SlackBlocks(blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, exp interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &exp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got blocks\n%s\nwant\n%s", data, want)
+	}
+}
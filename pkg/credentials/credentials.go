@@ -1,8 +1,39 @@
 package credentials
 
-// various credentials. Must be populated externally.
-var (
-	SlackBotToken      string
-	SlackAppLevelToken string
-	PagerDutyAPIKey    string
-)
+import "fmt"
+
+// Credentials holds the credentials used by the bot and its plugins. They are
+// read from the `credentials` section of the configuration file and passed to
+// plugins through their services. Each value is either a literal or a
+// reference to a secret, see Resolve.
+type Credentials struct {
+	PagerDutyAPIKey    Secret `mapstructure:"pagerduty_api_key"`
+	SlackBotToken      Secret `mapstructure:"slack_bot_token"`
+	SlackAppLevelToken Secret `mapstructure:"slack_app_level_token"`
+
+	resolved bool
+}
+
+// Resolve replaces the secret references with their values. It does nothing
+// if the credentials were already resolved.
+func (c *Credentials) Resolve() error {
+	if c.resolved {
+		return nil
+	}
+	for _, f := range []struct {
+		name   string
+		secret *Secret
+	}{
+		{"pagerduty_api_key", &c.PagerDutyAPIKey},
+		{"slack_bot_token", &c.SlackBotToken},
+		{"slack_app_level_token", &c.SlackAppLevelToken},
+	} {
+		s, err := Resolve(string(*f.secret))
+		if err != nil {
+			return fmt.Errorf("failed to resolve credentials.%s: %w", f.name, err)
+		}
+		*f.secret = s
+	}
+	c.resolved = true
+	return nil
+}
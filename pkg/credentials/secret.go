@@ -0,0 +1,102 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Redacted is printed in place of the value of a non-empty Secret.
+const Redacted = "[REDACTED]"
+
+// ExecTimeout is the maximum time an `exec:` secret command can run.
+var ExecTimeout = 30 * time.Second
+
+// Secret is a secret value, e.g. an API token. Its value is never printed or
+// marshalled, use Value to read it.
+type Secret string
+
+// Value returns the secret value.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns Redacted, or an empty string if the secret is empty.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// GoString implements fmt.GoStringer, so that the value is redacted with %#v
+// too.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalText implements encoding.TextMarshaler, redacting the value.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Resolve returns the value of a secret reference, which is one of:
+//   - `env:VAR`, the value of the environment variable VAR;
+//   - `file:/path`, the content of the file at /path;
+//   - `exec:command`, the output of command, run with `sh -c`;
+//   - anything else, which is used literally.
+//
+// Leading and trailing white space is removed from the values read from
+// files and commands. It is an error if a referenced value is empty.
+func Resolve(ref string) (Secret, error) {
+	kind, arg, ok := strings.Cut(ref, ":")
+	if !ok {
+		return Secret(ref), nil
+	}
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(arg)
+		if !ok || v == "" {
+			return "", fmt.Errorf("environment variable %q is not set", arg)
+		}
+		return Secret(v), nil
+	case "file":
+		path, err := homedir.Expand(arg)
+		if err != nil {
+			return "", fmt.Errorf("failed to expand path %q: %w", arg, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		v := strings.TrimSpace(string(data))
+		if v == "" {
+			return "", fmt.Errorf("secret file %q is empty", path)
+		}
+		return Secret(v), nil
+	case "exec":
+		ctx, cancel := context.WithTimeout(context.Background(), ExecTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", arg)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret command %q failed: %w: %s", arg, err, strings.TrimSpace(stderr.String()))
+		}
+		v := strings.TrimSpace(string(out))
+		if v == "" {
+			return "", fmt.Errorf("secret command %q returned an empty value", arg)
+		}
+		return Secret(v), nil
+	default:
+		// e.g. a literal token containing a colon
+		return Secret(ref), nil
+	}
+}
@@ -0,0 +1,96 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACKBOT_TEST_TOKEN", "from-env")
+	for _, tc := range []struct {
+		ref, want string
+	}{
+		{"xoxb-literal", "xoxb-literal"},
+		{"env:SLACKBOT_TEST_TOKEN", "from-env"},
+		{"file:" + path, "from-file"},
+		{"exec:echo '  from-exec  '", "from-exec"},
+		{"https://example.com", "https://example.com"},
+		{"", ""},
+	} {
+		got, err := Resolve(tc.ref)
+		if err != nil {
+			t.Errorf("Resolve(%q): unexpected error: %v", tc.ref, err)
+			continue
+		}
+		if got.Value() != tc.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tc.ref, got.Value(), tc.want)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte(" \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACKBOT_TEST_EMPTY", "")
+	for _, ref := range []string{
+		"env:SLACKBOT_TEST_UNSET",
+		"env:SLACKBOT_TEST_EMPTY",
+		"file:" + filepath.Join(dir, "missing"),
+		"file:" + empty,
+		"exec:exit 1",
+		"exec:true",
+	} {
+		if _, err := Resolve(ref); err == nil {
+			t.Errorf("Resolve(%q): expected an error", ref)
+		}
+	}
+}
+
+func TestCredentialsResolve(t *testing.T) {
+	t.Setenv("SLACKBOT_TEST_TOKEN", "xoxb-secret")
+	c := Credentials{SlackBotToken: "env:SLACKBOT_TEST_TOKEN", PagerDutyAPIKey: "env:SLACKBOT_TEST_UNSET"}
+	err := c.Resolve()
+	if err == nil || !strings.Contains(err.Error(), "pagerduty_api_key") {
+		t.Errorf("got %v, want an error naming pagerduty_api_key", err)
+	}
+	c.PagerDutyAPIKey = "literal"
+	if err := c.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if c.SlackBotToken.Value() != "xoxb-secret" {
+		t.Errorf("got %q, want the resolved token", c.SlackBotToken.Value())
+	}
+	// resolved credentials are not resolved again.
+	c.SlackAppLevelToken = "env:SLACKBOT_TEST_UNSET"
+	if err := c.Resolve(); err != nil {
+		t.Errorf("second Resolve: unexpected error: %v", err)
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	s := Secret("xoxb-secret")
+	data, err := json.Marshal(struct{ Token Secret }{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range []string{fmt.Sprint(s), fmt.Sprintf("%v %s %#v %+v", s, s, s, struct{ S Secret }{s}), string(data)} {
+		if strings.Contains(out, "xoxb") || !strings.Contains(out, Redacted) {
+			t.Errorf("secret not redacted in %q", out)
+		}
+	}
+	if got := Secret("").String(); got != "" {
+		t.Errorf("empty secret printed as %q", got)
+	}
+}
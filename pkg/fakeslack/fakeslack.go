@@ -0,0 +1,751 @@
+// Package fakeslack implements a local stand-in for the Slack web API and the
+// Socket Mode websocket protocol, so that the bot can be exercised end-to-end
+// without a connection to Slack.
+//
+// A typical test starts a Server, points the bot's `slack_api_url` at
+// Server.APIURL, injects events with SendMessage or SendEvent and inspects
+// what the bot posted with WaitForPost or Calls.
+package fakeslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultPingInterval is how often the server pings connected Socket Mode
+// clients. The Slack client reconnects if it is not pinged for 30 seconds.
+var DefaultPingInterval = 5 * time.Second
+
+// Call is a web API call received by the server.
+type Call struct {
+	Method string
+	Params url.Values
+	// Body is the raw request body for JSON-encoded calls.
+	Body []byte
+}
+
+// Post is a message posted with chat.postMessage or chat.postEphemeral.
+type Post struct {
+	Channel   string
+	ThreadTS  string
+	Text      string
+	Timestamp string
+	// Blocks are the JSON-encoded layout blocks, if any.
+	Blocks json.RawMessage
+	// Ephemeral is the user an ephemeral message was shown to.
+	Ephemeral string
+	// ResponseType is set for the responses to slash commands, to
+	// "in_channel" or "ephemeral".
+	ResponseType string
+	Params       url.Values
+}
+
+// View is a modal view opened with views.open or views.push.
+type View struct {
+	ID        string
+	TriggerID string
+	// View is the JSON-encoded view, as last opened or updated.
+	View json.RawMessage
+}
+
+// User is a user known to the server, returned by users.lookupByEmail.
+type User struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// Server is a fake Slack server.
+type Server struct {
+	// BotUserID and BotID are returned by auth.test.
+	BotUserID string
+	BotID     string
+	// Scopes are the OAuth scopes returned by auth.test in the X-OAuth-Scopes
+	// header.
+	Scopes []string
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	calls    []Call
+	posts    []Post
+	users    map[string]User
+	groups   map[string][]string
+	acks     map[string]json.RawMessage
+	conns    []*websocket.Conn
+	seq      int
+	postCh   chan Post
+	ackCh    chan string
+	closed   chan struct{}
+
+	// responses maps the response URL IDs to the slash commands.
+	responses map[string]slashCommand
+	views     []View
+}
+
+// New starts a new fake Slack server. Call Close when done.
+func New() *Server {
+	s := &Server{
+		BotUserID: "UBOT",
+		BotID:     "BBOT",
+		Scopes:    []string{"app_mentions:read", "channels:history", "chat:write", "commands", "groups:history", "im:history", "users:read", "users:read.email"},
+		handlers:  make(map[string]http.HandlerFunc),
+		users:     make(map[string]User),
+		groups:    make(map[string][]string),
+		acks:      make(map[string]json.RawMessage),
+		responses: make(map[string]slashCommand),
+		postCh:    make(chan Post, 100),
+		ackCh:     make(chan string, 100),
+		closed:    make(chan struct{}),
+	}
+	// the Slack client sets the Origin header to https://api.slack.com
+	s.upgrader.CheckOrigin = func(*http.Request) bool { return true }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", s.handleAPI)
+	mux.HandleFunc("/ws", s.handleWebsocket)
+	mux.HandleFunc("/response/", s.handleResponse)
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// APIURL returns the URL to pass to slack.OptionAPIURL.
+func (s *Server) APIURL() string {
+	return s.srv.URL + "/api/"
+}
+
+// Close shuts the server down and closes all the websocket connections.
+func (s *Server) Close() {
+	close(s.closed)
+	s.mu.Lock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.srv.Close()
+}
+
+// AddUser makes a user available to users.lookupByEmail.
+func (s *Server) AddUser(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.Email] = u
+}
+
+// AddUserGroup makes a user group available to usergroups.list.
+func (s *Server) AddUserGroup(handle string, members ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[handle] = members
+}
+
+// Handle overrides the handler of a web API method, e.g. "chat.postMessage".
+func (s *Server) Handle(method string, h http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Calls returns all the web API calls received so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Posts returns the messages posted so far, as updated by chat.update.
+// Deleted messages are not returned.
+func (s *Server) Posts() []Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Post(nil), s.posts...)
+}
+
+// Views returns the modal views opened so far.
+func (s *Server) Views() []View {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]View(nil), s.views...)
+}
+
+// WaitForPost waits for the next message posted with chat.postMessage or
+// chat.postEphemeral.
+func (s *Server) WaitForPost(timeout time.Duration) (Post, error) {
+	select {
+	case p := <-s.postCh:
+		return p, nil
+	case <-time.After(timeout):
+		return Post{}, fmt.Errorf("no message posted within %s", timeout)
+	}
+}
+
+// WaitForConnection waits until at least one Socket Mode client is connected.
+func (s *Server) WaitForConnection(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		n := len(s.conns)
+		s.mu.Unlock()
+		if n > 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no Socket Mode connection within %s", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// WaitForAck waits until the envelope with the given ID is acknowledged, and
+// returns the ack payload, if any.
+func (s *Server) WaitForAck(envelopeID string, timeout time.Duration) (json.RawMessage, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		payload, ok := s.acks[envelopeID]
+		s.mu.Unlock()
+		if ok {
+			return payload, nil
+		}
+		select {
+		case <-s.ackCh:
+		case <-deadline:
+			return nil, fmt.Errorf("envelope %s not acknowledged within %s", envelopeID, timeout)
+		}
+	}
+}
+
+// nextID returns a new monotonic identifier. Must be called with s.mu held.
+func (s *Server) nextID() int {
+	s.seq++
+	return s.seq
+}
+
+// SendEnvelope sends a Socket Mode envelope of the given type (e.g.
+// "events_api", "slash_commands", "interactive") with the given payload to
+// all the connected clients, and returns its envelope ID.
+func (s *Server) SendEnvelope(typ string, payload interface{}) (string, error) {
+	p, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := fmt.Sprintf("envelope-%d", s.nextID())
+	env := map[string]interface{}{
+		"type":                     typ,
+		"envelope_id":              id,
+		"payload":                  json.RawMessage(p),
+		"accepts_response_payload": typ != "events_api",
+	}
+	if len(s.conns) == 0 {
+		return "", fmt.Errorf("no Socket Mode client connected")
+	}
+	for _, c := range s.conns {
+		if err := c.WriteJSON(env); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// SendEvent wraps an Events API inner event (e.g. a "message" or
+// "app_mention" object) in an event_callback and sends it to the connected
+// clients. It returns the envelope ID.
+func (s *Server) SendEvent(event map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	eventID := fmt.Sprintf("Ev%06d", s.nextID())
+	s.mu.Unlock()
+	return s.SendEnvelope("events_api", map[string]interface{}{
+		"type":       "event_callback",
+		"event_id":   eventID,
+		"event_time": time.Now().Unix(),
+		"event":      event,
+	})
+}
+
+// SendMessage sends a "message" event from the given user in the given
+// channel, and returns its envelope ID.
+func (s *Server) SendMessage(channel, user, text string) (string, error) {
+	return s.SendEvent(map[string]interface{}{
+		"type":         "message",
+		"channel":      channel,
+		"channel_type": "channel",
+		"user":         user,
+		"text":         text,
+		"ts":           s.newTS(),
+	})
+}
+
+// SendDirectMessage sends a "message" event from the given user in the direct
+// message channel with the bot, and returns its envelope ID.
+func (s *Server) SendDirectMessage(channel, user, text string) (string, error) {
+	return s.SendEvent(map[string]interface{}{
+		"type":         "message",
+		"channel":      channel,
+		"channel_type": "im",
+		"user":         user,
+		"text":         text,
+		"ts":           s.newTS(),
+	})
+}
+
+// SendMessageChanged sends a "message_changed" event for the message ts of
+// user in channel, whose text was edited from oldText to text, and returns
+// its envelope ID.
+func (s *Server) SendMessageChanged(channel, ts, user, oldText, text string) (string, error) {
+	return s.SendEvent(map[string]interface{}{
+		"type":         "message",
+		"subtype":      "message_changed",
+		"channel":      channel,
+		"channel_type": "channel",
+		"hidden":       true,
+		"ts":           s.newTS(),
+		"message": map[string]interface{}{
+			"type": "message",
+			"user": user,
+			"text": text,
+			"ts":   ts,
+			"edited": map[string]interface{}{
+				"user": user,
+				"ts":   s.newTS(),
+			},
+		},
+		"previous_message": map[string]interface{}{
+			"type": "message",
+			"user": user,
+			"text": oldText,
+			"ts":   ts,
+		},
+	})
+}
+
+// SendMessageDeleted sends a "message_deleted" event for the message ts of
+// user in channel, and returns its envelope ID.
+func (s *Server) SendMessageDeleted(channel, ts, user, text string) (string, error) {
+	return s.SendEvent(map[string]interface{}{
+		"type":         "message",
+		"subtype":      "message_deleted",
+		"channel":      channel,
+		"channel_type": "channel",
+		"hidden":       true,
+		"deleted_ts":   ts,
+		"ts":           s.newTS(),
+		"previous_message": map[string]interface{}{
+			"type": "message",
+			"user": user,
+			"text": text,
+			"ts":   ts,
+		},
+	})
+}
+
+type slashCommand struct {
+	command string
+	channel string
+	user    string
+	// ts is the timestamp of the last in-channel response, which can be
+	// replaced or deleted.
+	ts string
+}
+
+// SendSlashCommand sends a slash command, e.g. "/oncall", invoked by user in
+// channel, and returns its envelope ID. The responses sent to its response
+// URL are recorded as posts.
+func (s *Server) SendSlashCommand(command, channel, user, text string) (string, error) {
+	s.mu.Lock()
+	id := fmt.Sprintf("%d", s.nextID())
+	s.responses[id] = slashCommand{command: command, channel: channel, user: user}
+	s.mu.Unlock()
+	return s.SendEnvelope("slash_commands", map[string]interface{}{
+		"command":      command,
+		"text":         text,
+		"channel_id":   channel,
+		"user_id":      user,
+		"response_url": s.srv.URL + "/response/" + id,
+		"trigger_id":   "trigger-" + id,
+	})
+}
+
+// handleResponse handles the responses sent to the response URL of a slash
+// command.
+func (s *Server) handleResponse(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/response/")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var resp struct {
+		Text            string          `json:"text"`
+		Blocks          json.RawMessage `json:"blocks"`
+		ResponseType    string          `json:"response_type"`
+		ReplaceOriginal bool            `json:"replace_original"`
+		DeleteOriginal  bool            `json:"delete_original"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: "response_url", Body: body})
+	sc, ok := s.responses[id]
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "unknown response URL", http.StatusNotFound)
+		return
+	}
+	if resp.ReplaceOriginal || resp.DeleteOriginal {
+		for i, p := range s.posts {
+			if p.Channel != sc.channel || p.Timestamp != sc.ts || sc.ts == "" {
+				continue
+			}
+			if resp.DeleteOriginal {
+				s.posts = append(s.posts[:i], s.posts[i+1:]...)
+			} else {
+				s.posts[i].Text = resp.Text
+				s.posts[i].Blocks = resp.Blocks
+			}
+			break
+		}
+		s.mu.Unlock()
+		w.Write([]byte("ok"))
+		return
+	}
+	p := Post{
+		Channel:      sc.channel,
+		Text:         resp.Text,
+		Blocks:       resp.Blocks,
+		Timestamp:    fmt.Sprintf("%d.%06d", time.Now().Unix(), s.nextID()),
+		ResponseType: resp.ResponseType,
+	}
+	if p.ResponseType != "in_channel" {
+		p.ResponseType = "ephemeral"
+		p.Ephemeral = sc.user
+	} else {
+		sc.ts = p.Timestamp
+		s.responses[id] = sc
+	}
+	s.posts = append(s.posts, p)
+	s.mu.Unlock()
+	select {
+	case s.postCh <- p:
+	default:
+	}
+	w.Write([]byte("ok"))
+}
+
+// SendBlockAction sends a click by user on a button with the given action
+// ID and value, in the message posted in channel at messageTS, and returns
+// the envelope ID.
+func (s *Server) SendBlockAction(channel, user, messageTS, actionID, value string) (string, error) {
+	s.mu.Lock()
+	trigger := fmt.Sprintf("trigger-%d", s.nextID())
+	text := ""
+	for _, p := range s.posts {
+		if p.Channel == channel && p.Timestamp == messageTS {
+			text = p.Text
+		}
+	}
+	s.mu.Unlock()
+	return s.SendEnvelope("interactive", map[string]interface{}{
+		"type":       "block_actions",
+		"trigger_id": trigger,
+		"user":       map[string]interface{}{"id": user},
+		"channel":    map[string]interface{}{"id": channel},
+		"container": map[string]interface{}{
+			"type":       "message",
+			"message_ts": messageTS,
+			"channel_id": channel,
+		},
+		"message": map[string]interface{}{"ts": messageTS, "text": text, "user": s.BotUserID},
+		"actions": []map[string]interface{}{{
+			"type":      "button",
+			"action_id": actionID,
+			"block_id":  "block",
+			"value":     value,
+		}},
+	})
+}
+
+// SendViewSubmission sends the submission by user of a modal view, with the
+// given text input values by action ID, and returns the envelope ID. The
+// acknowledgement payload, e.g. validation errors, can be read with
+// WaitForAck.
+func (s *Server) SendViewSubmission(viewID, callbackID, user string, values map[string]string) (string, error) {
+	state := make(map[string]interface{})
+	for actionID, value := range values {
+		state[actionID] = map[string]interface{}{
+			actionID: map[string]interface{}{"type": "plain_text_input", "value": value},
+		}
+	}
+	return s.SendEnvelope("interactive", map[string]interface{}{
+		"type": "view_submission",
+		"user": map[string]interface{}{"id": user},
+		"view": map[string]interface{}{
+			"id":          viewID,
+			"callback_id": callbackID,
+			"state":       map[string]interface{}{"values": state},
+		},
+	})
+}
+
+// SendViewClosed sends the dismissal by user of a modal view, and returns
+// the envelope ID.
+func (s *Server) SendViewClosed(viewID, callbackID, user string) (string, error) {
+	return s.SendEnvelope("interactive", map[string]interface{}{
+		"type": "view_closed",
+		"user": map[string]interface{}{"id": user},
+		"view": map[string]interface{}{"id": viewID, "callback_id": callbackID},
+	})
+}
+
+func (s *Server) newTS() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d.%06d", time.Now().Unix(), s.nextID())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	call := Call{Method: method}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		call.Body = body
+		call.Params = r.URL.Query()
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		call.Params = r.Form
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	h := s.handlers[method]
+	s.mu.Unlock()
+	if h != nil {
+		h(w, r)
+		return
+	}
+
+	switch method {
+	case "apps.connections.open":
+		u := "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/ws"
+		writeJSON(w, map[string]interface{}{"ok": true, "url": u})
+	case "auth.test":
+		s.mu.Lock()
+		w.Header().Set("X-OAuth-Scopes", strings.Join(s.Scopes, ","))
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{
+			"ok":      true,
+			"url":     s.srv.URL + "/",
+			"team":    "fake",
+			"user":    "bot",
+			"team_id": "TFAKE",
+			"user_id": s.BotUserID,
+			"bot_id":  s.BotID,
+		})
+	case "chat.postMessage", "chat.postEphemeral":
+		p := Post{
+			Channel:   call.Params.Get("channel"),
+			ThreadTS:  call.Params.Get("thread_ts"),
+			Text:      call.Params.Get("text"),
+			Timestamp: s.newTS(),
+			Ephemeral: call.Params.Get("user"),
+			Params:    call.Params,
+		}
+		if blocks := call.Params.Get("blocks"); blocks != "" {
+			p.Blocks = json.RawMessage(blocks)
+		}
+		s.mu.Lock()
+		s.posts = append(s.posts, p)
+		s.mu.Unlock()
+		select {
+		case s.postCh <- p:
+		default:
+		}
+		if method == "chat.postEphemeral" {
+			writeJSON(w, map[string]interface{}{"ok": true, "message_ts": p.Timestamp})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"ok": true, "channel": p.Channel, "ts": p.Timestamp})
+	case "chat.update", "chat.delete":
+		channel, ts := call.Params.Get("channel"), call.Params.Get("ts")
+		s.mu.Lock()
+		found := false
+		for i, p := range s.posts {
+			if p.Channel != channel || p.Timestamp != ts || p.Ephemeral != "" {
+				continue
+			}
+			found = true
+			if method == "chat.delete" {
+				s.posts = append(s.posts[:i], s.posts[i+1:]...)
+				break
+			}
+			s.posts[i].Text = call.Params.Get("text")
+			s.posts[i].Blocks = json.RawMessage(call.Params.Get("blocks"))
+			s.posts[i].Params = call.Params
+			break
+		}
+		s.mu.Unlock()
+		if !found {
+			writeJSON(w, map[string]interface{}{"ok": false, "error": "message_not_found"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"ok": true, "channel": channel, "ts": ts, "text": call.Params.Get("text")})
+	case "views.open", "views.push", "views.update":
+		var req struct {
+			TriggerID string          `json:"trigger_id"`
+			ViewID    string          `json:"view_id"`
+			View      json.RawMessage `json:"view"`
+		}
+		if err := json.Unmarshal(call.Body, &req); err != nil {
+			writeJSON(w, map[string]interface{}{"ok": false, "error": "invalid_arguments"})
+			return
+		}
+		s.mu.Lock()
+		id := req.ViewID
+		if method == "views.update" {
+			found := false
+			for i, v := range s.views {
+				if v.ID == id {
+					s.views[i].View = req.View
+					found = true
+				}
+			}
+			if !found {
+				s.mu.Unlock()
+				writeJSON(w, map[string]interface{}{"ok": false, "error": "not_found"})
+				return
+			}
+		} else {
+			id = fmt.Sprintf("V%06d", s.nextID())
+			s.views = append(s.views, View{ID: id, TriggerID: req.TriggerID, View: req.View})
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"ok": true, "view": map[string]interface{}{"id": id}})
+	case "users.lookupByEmail":
+		s.mu.Lock()
+		u, ok := s.users[call.Params.Get("email")]
+		s.mu.Unlock()
+		if !ok {
+			writeJSON(w, map[string]interface{}{"ok": false, "error": "users_not_found"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"ok": true,
+			"user": map[string]interface{}{
+				"id":      u.ID,
+				"name":    u.Name,
+				"profile": map[string]interface{}{"email": u.Email},
+			},
+		})
+	case "usergroups.list":
+		s.mu.Lock()
+		groups := make([]map[string]interface{}, 0, len(s.groups))
+		for handle, members := range s.groups {
+			groups = append(groups, map[string]interface{}{
+				"id":     "S" + strings.ToUpper(handle),
+				"handle": handle,
+				"users":  members,
+			})
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"ok": true, "usergroups": groups})
+	default:
+		writeJSON(w, map[string]interface{}{"ok": true})
+	}
+}
+
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	if err := conn.WriteJSON(map[string]interface{}{
+		"type":            "hello",
+		"num_connections": 1,
+	}); err != nil {
+		s.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go s.pingLoop(conn, done)
+	defer func() {
+		close(done)
+		s.removeConn(conn)
+	}()
+	for {
+		var res struct {
+			EnvelopeID string          `json:"envelope_id"`
+			Payload    json.RawMessage `json:"payload"`
+		}
+		if err := conn.ReadJSON(&res); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.acks[res.EnvelopeID] = res.Payload
+		s.mu.Unlock()
+		select {
+		case s.ackCh <- res.EnvelopeID:
+		default:
+		}
+	}
+}
+
+func (s *Server) pingLoop(conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(DefaultPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second))
+			s.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) removeConn(conn *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.conns {
+		if c == conn {
+			s.conns = append(s.conns[:i], s.conns[i+1:]...)
+			break
+		}
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,152 @@
+// Package logging configures the structured logger shared by the bot and its
+// plugins.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config is the logging configuration.
+type Config struct {
+	// Level is the minimum level of the logged messages: debug, info, warn or
+	// error. Defaults to info.
+	Level string `mapstructure:"level,omitempty"`
+	// Format is either "text" or "json". JSON logs are written one object per
+	// line.
+	Format string `mapstructure:"format,omitempty"`
+	// File is the path of the log file. If empty, logs go to stderr.
+	File string `mapstructure:"file,omitempty"`
+	// MaxSize is the size in megabytes after which the log file is rotated.
+	// Zero disables rotation by size.
+	MaxSize int `mapstructure:"max_size,omitempty"`
+	// MaxAge is how long a log file is written to before being rotated, e.g.
+	// "24h". Zero disables rotation by age.
+	MaxAge time.Duration `mapstructure:"max_age,omitempty"`
+	// MaxBackups is the number of rotated files to keep. Zero keeps all of
+	// them.
+	MaxBackups int `mapstructure:"max_backups,omitempty"`
+}
+
+// Validate checks the configuration and sets the defaults.
+func (c *Config) Validate() error {
+	if c.Level == "" {
+		c.Level = logrus.InfoLevel.String()
+	}
+	if _, err := logrus.ParseLevel(c.Level); err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	switch c.Format {
+	case "":
+		c.Format = FormatText
+	case FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("invalid log format %q, must be %q or %q", c.Format, FormatText, FormatJSON)
+	}
+	f, err := homedir.Expand(c.File)
+	if err != nil {
+		return fmt.Errorf("failed to expand log file path: %w", err)
+	}
+	c.File = f
+	if c.MaxSize < 0 || c.MaxAge < 0 || c.MaxBackups < 0 {
+		return fmt.Errorf("log rotation settings cannot be negative")
+	}
+	return nil
+}
+
+// Setup configures l according to c, which must have been validated, and
+// redirects the standard library's logger to it. The returned closer closes
+// the log file, if any, and restores the standard library's logger.
+func Setup(l *logrus.Logger, c Config) (io.Closer, error) {
+	level, err := logrus.ParseLevel(c.Level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if c.File != "" {
+		rf, err := OpenRotatingFile(c.File, int64(c.MaxSize)<<20, c.MaxAge, c.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = rf
+	}
+	l.SetLevel(level)
+	if c.Format == FormatJSON {
+		l.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		l.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+	l.SetOutput(out)
+
+	stdOut, stdFlags := log.Writer(), log.Flags()
+	log.SetOutput(Writer(logrus.NewEntry(l), logrus.InfoLevel))
+	log.SetFlags(0)
+	return closerFunc(func() error {
+		log.SetOutput(stdOut)
+		log.SetFlags(stdFlags)
+		l.SetOutput(os.Stderr)
+		return out.Close()
+	}), nil
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the logger e.
+func NewContext(ctx context.Context, e *logrus.Entry) context.Context {
+	return context.WithValue(ctx, ctxKey{}, e)
+}
+
+// FromContext returns the logger carried by ctx, or the standard logger.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if e, ok := ctx.Value(ctxKey{}).(*logrus.Entry); ok {
+		return e
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// Writer returns a writer that logs each write as a message with the given
+// level, e.g. to pass the logger to libraries that use the standard library's
+// logger.
+func Writer(e *logrus.Entry, level logrus.Level) io.Writer {
+	return levelWriter{entry: e, level: level}
+}
+
+// StdLogger returns a standard library logger that writes to e with the given
+// level.
+func StdLogger(e *logrus.Entry, level logrus.Level) *log.Logger {
+	return log.New(Writer(e, level), "", 0)
+}
+
+type levelWriter struct {
+	entry *logrus.Entry
+	level logrus.Level
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	w.entry.Log(w.level, strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the suffix format of the rotated log files. It sorts
+// lexicographically in chronological order.
+const backupTimeFormat = "20060102T150405.000"
+
+// rotateRetryInterval is how long to wait before retrying a failed rotation.
+var rotateRetryInterval = time.Minute
+
+// RotatingFile is a log file that is rotated when it grows larger than a
+// maximum size or older than a maximum age. The rotated files are renamed
+// appending a timestamp to their name. It is safe for concurrent use.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	// retryAt is when to retry a failed rotation.
+	retryAt time.Time
+}
+
+// OpenRotatingFile opens or creates the log file at path for appending. A
+// zero maxSize or maxAge disables the corresponding rotation, and a zero
+// maxBackups keeps all the rotated files.
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	rf := RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return &rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %q: %w", rf.path, err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat log file %q: %w", rf.path, err)
+	}
+	rf.f = f
+	rf.size = st.Size()
+	rf.opened = time.Now()
+	return nil
+}
+
+// Write writes p to the log file, rotating it first if needed. If the
+// rotation fails, p is still written to the current file, the error is
+// reported on the standard error, and the rotation is retried after
+// rotateRetryInterval.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.shouldRotate(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			rf.retryAt = time.Now().Add(rotateRetryInterval)
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file %q, retrying in %s: %v\n", rf.path, rotateRetryInterval, err)
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) shouldRotate(n int64) bool {
+	if rf.size == 0 || time.Now().Before(rf.retryAt) {
+		return false
+	}
+	if rf.maxSize > 0 && rf.size+n > rf.maxSize {
+		return true
+	}
+	return rf.maxAge > 0 && time.Since(rf.opened) > rf.maxAge
+}
+
+// rotate renames the current file, opens a new one, and removes the oldest
+// rotated files.
+func (rf *RotatingFile) rotate() error {
+	backup := rf.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(rf.path, backup); err != nil {
+		// e.g. the file was removed: reopen it, or keep the current
+		// handle if that fails too, and retry on the next write.
+		_ = rf.reopen()
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := rf.reopen(); err != nil {
+		return err
+	}
+	if rf.maxBackups == 0 {
+		return nil
+	}
+	backups, err := rf.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > rf.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("failed to remove rotated log file: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backups returns the rotated files, oldest first. Other files with the same
+// prefix, e.g. "bot.log.lock", are ignored.
+func (rf *RotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated log files: %w", err)
+	}
+	var backups []string
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, rf.path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// reopen opens the file at path, replacing the current handle. The current
+// handle is kept if the file cannot be opened.
+func (rf *RotatingFile) reopen() error {
+	old := rf.f
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if err := old.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
@@ -0,0 +1,193 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// backups returns the rotated files of the log file at path, oldest first.
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	files, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func write(t *testing.T, rf *RotatingFile, s string) {
+	t.Helper()
+	if _, err := rf.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	// rotated files are named after the time in milliseconds.
+	time.Sleep(2 * time.Millisecond)
+}
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	rf, err := OpenRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	for _, s := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		write(t, rf, s)
+	}
+	if got := readFile(t, path); got != "gggg\n" {
+		t.Errorf("got %q in the current file, want %q", got, "gggg\n")
+	}
+	b := backups(t, path)
+	if len(b) != 2 {
+		t.Fatalf("got %d rotated files, want 2", len(b))
+	}
+	if got := readFile(t, b[0]) + readFile(t, b[1]); got != "cccc\ndddd\neeee\nffff\n" {
+		t.Errorf("got %q in the rotated files", got)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	rf, err := OpenRotatingFile(path, 0, 20*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	write(t, rf, "old\n")
+	time.Sleep(30 * time.Millisecond)
+	write(t, rf, "new\n")
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("got %q in the current file, want %q", got, "new\n")
+	}
+	if b := backups(t, path); len(b) != 1 || readFile(t, b[0]) != "old\n" {
+		t.Errorf("got rotated files %q, want one with the old line", b)
+	}
+}
+
+func TestReopenAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	for _, s := range []string{"one\n", "two\n"} {
+		rf, err := OpenRotatingFile(path, 100, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, rf, s)
+		if err := rf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, path); got != "one\ntwo\n" {
+		t.Errorf("got %q, want both lines", got)
+	}
+	if b := backups(t, path); len(b) != 0 {
+		t.Errorf("got unexpected rotated files %q", b)
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	rf, err := OpenRotatingFile(filepath.Join(t.TempDir(), "bot.log"), 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Write([]byte("late\n")); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestRotateRemovedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	rf, err := OpenRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	write(t, rf, "aaaa\n")
+	write(t, rf, "bbbb\n")
+	// the rotation fails, e.g. because the file was removed by hand.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rf.Write([]byte("cccc\n")); err != nil || n != 5 {
+		t.Errorf("got %d, %v, want the line written without error", n, err)
+	}
+	write(t, rf, "dddd\n")
+	if got := readFile(t, path); got != "cccc\ndddd\n" {
+		t.Errorf("got %q in the reopened file, want the lines written after the failure", got)
+	}
+	if b := backups(t, path); len(b) != 0 {
+		t.Errorf("got unexpected rotated files %q", b)
+	}
+}
+
+func TestRotateRetry(t *testing.T) {
+	defer func(d time.Duration) { rotateRetryInterval = d }(rotateRetryInterval)
+	rotateRetryInterval = 50 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "bot.log")
+	rf, err := OpenRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	write(t, rf, "aaaa\n")
+	write(t, rf, "bbbb\n")
+	// the rotation fails, and the file is reopened.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	write(t, rf, "cccc\n")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	// the rotation is not retried right away.
+	write(t, rf, "dddddddddd\n")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the rotation was retried before the retry interval: %v", err)
+	}
+	time.Sleep(rotateRetryInterval)
+	write(t, rf, "eeee\n")
+	if got := readFile(t, path); got != "eeee\n" {
+		t.Errorf("got %q in the reopened file, want the line written after the retry", got)
+	}
+}
+
+func TestRotateKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	old := path + ".20200101T000000.000"
+	others := []string{path + ".gz.bak", path + ".lock", path + ".1"}
+	for _, f := range append(others, old) {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rf, err := OpenRotatingFile(path, 10, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	write(t, rf, "aaaaaaaa\n")
+	write(t, rf, "bbbbbbbb\n")
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("the oldest rotated file was not removed: %v", err)
+	}
+	for _, f := range others {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("unrelated file removed: %v", err)
+		}
+	}
+}
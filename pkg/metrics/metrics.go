@@ -0,0 +1,288 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default histogram buckets, in seconds, suitable for
+// command and HTTP request durations.
+var DefaultBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds a set of metrics. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]*metric
+}
+
+// NewRegistry returns a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*metric)}
+}
+
+type kind string
+
+const (
+	kindCounter   kind = "counter"
+	kindGauge     kind = "gauge"
+	kindHistogram kind = "histogram"
+)
+
+// metric is a metric family, with one series per combination of label
+// values.
+type metric struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// for histograms, value is the sum of the observations.
+	counts []uint64
+	count  uint64
+}
+
+// register returns the metric with the given name, creating it if needed. It
+// panics if a metric with the same name but a different type or labels was
+// already registered, which is a programming error.
+func (r *Registry) register(name, help string, k kind, buckets []float64, labels []string) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.metrics[name]; ok {
+		if m.kind != k || strings.Join(m.labels, ",") != strings.Join(labels, ",") {
+			panic(fmt.Sprintf("metrics: %s already registered as %s with labels %v", name, m.kind, m.labels))
+		}
+		return m
+	}
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    k,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	if len(labels) == 0 {
+		// metrics without labels are exported from the start
+		m.get(nil)
+	}
+	r.metrics[name] = m
+	return m
+}
+
+// get returns the series for the given label values, creating it if needed.
+// Must be called with m.mu held.
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == kindHistogram {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	m *metric
+}
+
+// Counter returns the counter with the given name and label names,
+// registering it if needed.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{m: r.register(name, help, kindCounter, nil, labels)}
+}
+
+// Inc increments the counter for the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values by v, which must not
+// be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.m.mu.Lock()
+	c.m.get(labelValues).value += v
+	c.m.mu.Unlock()
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	m *metric
+}
+
+// Gauge returns the gauge with the given name and label names, registering
+// it if needed.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m: r.register(name, help, kindGauge, nil, labels)}
+}
+
+// Set sets the gauge for the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.mu.Lock()
+	g.m.get(labelValues).value = v
+	g.m.mu.Unlock()
+}
+
+// Add adds v, which can be negative, to the gauge for the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.mu.Lock()
+	g.m.get(labelValues).value += v
+	g.m.mu.Unlock()
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	m *metric
+}
+
+// Histogram returns the histogram with the given name, buckets and label
+// names, registering it if needed. If buckets is nil, DefaultBuckets are used.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{m: r.register(name, help, kindHistogram, buckets, labels)}
+}
+
+// Observe records an observation for the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	s := h.m.get(labelValues)
+	for i, b := range h.m.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// WriteTo writes all the metrics to w in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]*metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mu.Unlock()
+
+	cw := countingWriter{w: bufio.NewWriter(w)}
+	for _, m := range metrics {
+		m.write(&cw)
+	}
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+func (m *metric) write(w *countingWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.printf("# HELP %s %s\n", m.name, escapeHelp(m.help))
+	w.printf("# TYPE %s %s\n", m.name, m.kind)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.kind != kindHistogram {
+			w.printf("%s%s %s\n", m.name, labelString(m.labels, s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		for i, b := range m.buckets {
+			w.printf("%s_bucket%s %d\n", m.name, labelString(m.labels, s.labelValues, "le", formatFloat(b)), s.counts[i])
+		}
+		w.printf("%s_bucket%s %d\n", m.name, labelString(m.labels, s.labelValues, "le", "+Inf"), s.count)
+		w.printf("%s_sum%s %s\n", m.name, labelString(m.labels, s.labelValues, "", ""), formatFloat(s.value))
+		w.printf("%s_count%s %d\n", m.name, labelString(m.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// labelString formats the labels of a series, with an optional extra label.
+func labelString(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) printf(format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(c.w, format, args...)
+	c.n += int64(n)
+	c.err = err
+}
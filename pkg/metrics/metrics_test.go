@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	// registered out of order: metrics are written sorted by name.
+	h := r.Histogram("slackbot_latency_seconds", "Command latency.", []float64{1, 0.1, 0.5}, "plugin")
+	c := r.Counter("slackbot_commands_total", "Commands handled,\nby plugin.", "plugin", "outcome")
+	g := r.Gauge("slackbot_connected", `Connection state, 1 if "connected".`)
+
+	c.Inc("pinger", "ok")
+	c.Add(2, "oncall", "ok")
+	c.Inc(`we"ird\plugin`+"\n", "error")
+	g.Set(1)
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		h.Observe(v, "oncall")
+	}
+	// the same name and labels return the registered metric.
+	r.Counter("slackbot_commands_total", "", "plugin", "outcome").Inc("pinger", "ok")
+
+	want := `# HELP slackbot_commands_total Commands handled,\nby plugin.
+# TYPE slackbot_commands_total counter
+slackbot_commands_total{plugin="oncall",outcome="ok"} 2
+slackbot_commands_total{plugin="pinger",outcome="ok"} 2
+slackbot_commands_total{plugin="we\"ird\\plugin\n",outcome="error"} 1
+# HELP slackbot_connected Connection state, 1 if "connected".
+# TYPE slackbot_connected gauge
+slackbot_connected 1
+# HELP slackbot_latency_seconds Command latency.
+# TYPE slackbot_latency_seconds histogram
+slackbot_latency_seconds_bucket{plugin="oncall",le="0.1"} 2
+slackbot_latency_seconds_bucket{plugin="oncall",le="0.5"} 3
+slackbot_latency_seconds_bucket{plugin="oncall",le="1"} 3
+slackbot_latency_seconds_bucket{plugin="oncall",le="+Inf"} 4
+slackbot_latency_seconds_sum{plugin="oncall"} 2.45
+slackbot_latency_seconds_count{plugin="oncall"} 4
+`
+	for i := 0; i < 3; i++ {
+		var sb strings.Builder
+		n, err := r.WriteTo(&sb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(sb.Len()) {
+			t.Errorf("WriteTo returned %d, wrote %d bytes", n, sb.Len())
+		}
+		if sb.String() != want {
+			t.Fatalf("got\n%s\nwant\n%s", sb.String(), want)
+		}
+	}
+}
+
+func TestRegisterConflict(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("slackbot_x_total", "", "plugin")
+	for name, register := range map[string]func(){
+		"type":   func() { r.Gauge("slackbot_x_total", "", "plugin") },
+		"labels": func() { r.Counter("slackbot_x_total", "", "instance") },
+		"values": func() { r.Counter("slackbot_x_total", "", "plugin").Inc() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
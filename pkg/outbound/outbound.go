@@ -0,0 +1,392 @@
+// Package outbound delivers the messages posted by the bot and its plugins,
+// preserving their order in each channel and retrying failed deliveries.
+package outbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/metrics"
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+// Defaults for the Config fields.
+var (
+	DefaultMaxPending     = 1000
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute
+)
+
+// FailedPrefix is the storage key prefix of the messages that could not be
+// delivered.
+const FailedPrefix = "outbound/failed/"
+
+var (
+	// ErrQueueFull is returned by Send when too many messages are pending.
+	ErrQueueFull = errors.New("too many pending outbound messages")
+	// ErrStopped is returned for the messages that were not delivered
+	// before the queue was stopped.
+	ErrStopped = errors.New("outbound queue stopped")
+)
+
+// Config is the configuration of the outbound queue.
+type Config struct {
+	// MaxPending is the maximum number of messages waiting to be delivered.
+	MaxPending int `mapstructure:"max_pending,omitempty"`
+	// MaxAttempts is the maximum number of delivery attempts per message.
+	MaxAttempts int `mapstructure:"max_attempts,omitempty"`
+	// InitialBackoff is the delay before the first retry. It doubles at
+	// every attempt, up to MaxBackoff. Rate limited requests are retried
+	// after the delay requested by Slack instead.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff,omitempty"`
+}
+
+// Validate checks the configuration and sets the defaults.
+func (c *Config) Validate() error {
+	if c.MaxPending < 0 || c.MaxAttempts < 0 || c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("outbound settings cannot be negative")
+	}
+	if c.MaxPending == 0 {
+		c.MaxPending = DefaultMaxPending
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = DefaultInitialBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+	return nil
+}
+
+// RetryPeriod returns how long the delivery of a message can be retried: the
+// sum of the delays between its attempts. It does not include the time taken
+// by the attempts, nor the longer delays that Slack can request for rate
+// limited requests.
+func (c Config) RetryPeriod() time.Duration {
+	var total time.Duration
+	backoff := c.InitialBackoff
+	for attempt := 1; attempt < c.MaxAttempts; attempt++ {
+		total += backoff
+		if backoff *= 2; backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+	return total
+}
+
+// Message is a message to deliver.
+type Message struct {
+	Channel  string `json:"channel"`
+	ThreadTS string `json:"thread_ts,omitempty"`
+	Text     string `json:"text"`
+	// Blocks are not recorded with the failed messages.
+	Blocks []chat.Block `json:"-"`
+}
+
+// FailedMessage is a message that could not be delivered, as recorded in
+// the storage.
+type FailedMessage struct {
+	Message
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+}
+
+// Delivery is the result of sending a message.
+type Delivery struct {
+	done chan struct{}
+	ref  chat.MessageRef
+	err  error
+}
+
+// Done returns a channel that is closed when the message was delivered or
+// ultimately failed.
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait waits for the message to be delivered, and returns a reference to it.
+// If ctx is done first, the delivery continues in the background.
+func (d *Delivery) Wait(ctx context.Context) (chat.MessageRef, error) {
+	select {
+	case <-d.done:
+		return d.ref, d.err
+	case <-ctx.Done():
+		return chat.MessageRef{}, ctx.Err()
+	}
+}
+
+type item struct {
+	msg      Message
+	delivery *Delivery
+}
+
+// Queue delivers messages through a chat.Client. Messages sent to the same
+// channel are delivered in order, one at a time; different channels are
+// delivered concurrently. It is safe for concurrent use.
+type Queue struct {
+	client chat.Client
+	store  storage.Store
+	log    *logrus.Entry
+	cfg    Config
+
+	pendingGauge *metrics.Gauge
+	failed       *metrics.Counter
+	retries      *metrics.Counter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	stopped  bool
+	pending  int
+	channels map[string][]*item
+	seq      int
+}
+
+// New returns a new Queue delivering messages through client. The messages
+// that cannot be delivered are recorded in store under FailedPrefix. cfg must
+// have been validated.
+func New(client chat.Client, store storage.Store, log *logrus.Entry, reg *metrics.Registry, cfg Config) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		client:       client,
+		store:        store,
+		log:          log,
+		cfg:          cfg,
+		pendingGauge: reg.Gauge("slackbot_outbound_pending", "Outbound messages waiting to be delivered."),
+		failed:       reg.Counter("slackbot_outbound_failed_total", "Outbound messages that could not be delivered."),
+		retries:      reg.Counter("slackbot_outbound_retries_total", "Outbound message delivery retries, by reason.", "reason"),
+		ctx:          ctx,
+		cancel:       cancel,
+		channels:     make(map[string][]*item),
+	}
+}
+
+// Config returns the configuration of the queue.
+func (q *Queue) Config() Config {
+	return q.cfg
+}
+
+// Send queues a message for delivery. It returns ErrQueueFull if too many
+// messages are pending, and ErrStopped if the queue was stopped.
+func (q *Queue) Send(msg Message) (*Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return nil, ErrStopped
+	}
+	if q.pending >= q.cfg.MaxPending {
+		return nil, ErrQueueFull
+	}
+	it := &item{msg: msg, delivery: &Delivery{done: make(chan struct{})}}
+	q.pending++
+	q.pendingGauge.Set(float64(q.pending))
+	queue := q.channels[msg.Channel]
+	q.channels[msg.Channel] = append(queue, it)
+	if len(queue) == 0 {
+		// no worker is delivering to this channel, start one.
+		q.wg.Add(1)
+		go q.worker(msg.Channel)
+	}
+	return it.delivery, nil
+}
+
+// worker delivers the messages queued for a channel, and exits when there
+// are no more.
+func (q *Queue) worker(channel string) {
+	defer q.wg.Done()
+	for {
+		q.mu.Lock()
+		it := q.channels[channel][0]
+		q.mu.Unlock()
+
+		it.delivery.ref, it.delivery.err = q.deliver(it.msg)
+		close(it.delivery.done)
+
+		q.mu.Lock()
+		q.pending--
+		q.pendingGauge.Set(float64(q.pending))
+		rest := q.channels[channel][1:]
+		if len(rest) == 0 {
+			delete(q.channels, channel)
+			q.mu.Unlock()
+			return
+		}
+		q.channels[channel] = rest
+		q.mu.Unlock()
+	}
+}
+
+// deliver posts a message, retrying on temporary errors.
+func (q *Queue) deliver(msg Message) (chat.MessageRef, error) {
+	backoff := q.cfg.InitialBackoff
+	var err error
+	attempt := 0
+	for attempt < q.cfg.MaxAttempts {
+		attempt++
+		var ref chat.MessageRef
+		ref, err = q.client.Post(q.ctx, &chat.OutgoingMessage{
+			Channel:  msg.Channel,
+			ThreadTS: msg.ThreadTS,
+			Text:     msg.Text,
+			Blocks:   msg.Blocks,
+		})
+		if err == nil {
+			return ref, nil
+		}
+		if q.ctx.Err() != nil {
+			err = ErrStopped
+			break
+		}
+		delay, reason, retry := retryDelay(err, backoff)
+		if !retry || attempt == q.cfg.MaxAttempts {
+			break
+		}
+		q.retries.Inc(reason)
+		q.log.WithField("channel", msg.Channel).Warnf("Failed to post message (attempt %d/%d), retrying in %s: %v", attempt, q.cfg.MaxAttempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-q.ctx.Done():
+			timer.Stop()
+		}
+		if q.ctx.Err() != nil {
+			err = ErrStopped
+			break
+		}
+		if backoff *= 2; backoff > q.cfg.MaxBackoff {
+			backoff = q.cfg.MaxBackoff
+		}
+	}
+	q.recordFailure(msg, attempt, err)
+	return chat.MessageRef{}, err
+}
+
+// retryDelay returns how long to wait before retrying after err, a label
+// describing the reason, and whether the error is temporary.
+func retryDelay(err error, backoff time.Duration) (time.Duration, string, bool) {
+	var rle *slack.RateLimitedError
+	if errors.As(err, &rle) {
+		return rle.RetryAfter, "rate_limited", true
+	}
+	var ser slack.SlackErrorResponse
+	if errors.As(err, &ser) {
+		// API errors, e.g. channel_not_found, are permanent.
+		return 0, "", false
+	}
+	var re interface{ Retryable() bool }
+	if errors.As(err, &re) {
+		return backoff, "server_error", re.Retryable()
+	}
+	// e.g. network errors
+	return backoff, "error", true
+}
+
+// recordFailure logs a message that could not be delivered and records it in
+// the storage.
+func (q *Queue) recordFailure(msg Message, attempts int, err error) {
+	q.failed.Inc()
+	q.log.WithField("channel", msg.Channel).Errorf("Failed to post message after %d attempt(s): %v", attempts, err)
+	now := time.Now()
+	data, merr := json.Marshal(FailedMessage{Message: msg, Error: err.Error(), Attempts: attempts, Time: now})
+	if merr != nil {
+		q.log.Errorf("Failed to marshal failed message: %v", merr)
+		return
+	}
+	q.mu.Lock()
+	q.seq++
+	key := fmt.Sprintf("%s%020d-%06d", FailedPrefix, now.UnixNano(), q.seq)
+	q.mu.Unlock()
+	// use a fresh context, so that failures are recorded during shutdown too.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.store.Put(ctx, key, data); err != nil {
+		q.log.Errorf("Failed to record failed message: %v", err)
+	}
+}
+
+// Failed returns the messages that could not be delivered, oldest first.
+func (q *Queue) Failed(ctx context.Context) ([]FailedMessage, error) {
+	keys, err := q.store.List(ctx, FailedPrefix)
+	if err != nil {
+		return nil, err
+	}
+	failed := make([]FailedMessage, 0, len(keys))
+	for _, key := range keys {
+		data, err := q.store.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		var fm FailedMessage
+		if err := json.Unmarshal(data, &fm); err != nil {
+			return nil, fmt.Errorf("invalid failed message %s: %w", key, err)
+		}
+		failed = append(failed, fm)
+	}
+	return failed, nil
+}
+
+// Stop stops accepting messages and waits for the pending ones to be
+// delivered, or for ctx to be done. In that case the remaining messages fail
+// with ErrStopped and are recorded as failed.
+func (q *Queue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	q.stopped = true
+	q.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Client returns a chat.Client that posts messages through the queue and
+// waits for their delivery. The other calls, including ephemeral messages,
+// go directly to the underlying client.
+func (q *Queue) Client() chat.Client {
+	return queuedClient{Client: q.client, q: q}
+}
+
+type queuedClient struct {
+	chat.Client
+	q *Queue
+}
+
+func (c queuedClient) PostMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	ref, err := c.Post(ctx, &chat.OutgoingMessage{Channel: channel, ThreadTS: threadTS, Text: text})
+	return ref.Timestamp, err
+}
+
+func (c queuedClient) Post(ctx context.Context, msg *chat.OutgoingMessage) (chat.MessageRef, error) {
+	d, err := c.q.Send(Message{Channel: msg.Channel, ThreadTS: msg.ThreadTS, Text: msg.Text, Blocks: msg.Blocks})
+	if err != nil {
+		return chat.MessageRef{}, err
+	}
+	return d.Wait(ctx)
+}
@@ -0,0 +1,223 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/chat/chattest"
+	"github.com/insomniacslk/slackbot/pkg/metrics"
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+// flakyClient is a chattest.Client whose posts fail with the errors returned
+// by fail, if not nil.
+type flakyClient struct {
+	*chattest.Client
+
+	mu       sync.Mutex
+	fail     func(msg *chat.OutgoingMessage, attempt int) error
+	attempts map[string]int
+}
+
+func newFlakyClient(fail func(msg *chat.OutgoingMessage, attempt int) error) *flakyClient {
+	return &flakyClient{Client: chattest.NewClient(), fail: fail, attempts: make(map[string]int)}
+}
+
+func (c *flakyClient) Post(ctx context.Context, msg *chat.OutgoingMessage) (chat.MessageRef, error) {
+	c.mu.Lock()
+	c.attempts[msg.Text]++
+	attempt := c.attempts[msg.Text]
+	c.mu.Unlock()
+	if err := c.fail(msg, attempt); err != nil {
+		return chat.MessageRef{}, err
+	}
+	return c.Client.Post(ctx, msg)
+}
+
+func newQueue(t *testing.T, client chat.Client, store storage.Store) *Queue {
+	t.Helper()
+	cfg := Config{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	q := New(client, store, logrus.NewEntry(logrus.New()), metrics.NewRegistry(), cfg)
+	t.Cleanup(func() {
+		_ = q.Stop(context.Background())
+	})
+	return q
+}
+
+func send(t *testing.T, q *Queue, channel, text string) *Delivery {
+	t.Helper()
+	d, err := q.Send(Message{Channel: channel, Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func wait(t *testing.T, d *Delivery) (chat.MessageRef, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return d.Wait(ctx)
+}
+
+func TestRetry(t *testing.T) {
+	client := newFlakyClient(func(msg *chat.OutgoingMessage, attempt int) error {
+		switch {
+		case msg.Text == "rate limited" && attempt == 1:
+			return &slack.RateLimitedError{RetryAfter: time.Millisecond}
+		case msg.Text == "network" && attempt < 3:
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	q := newQueue(t, client, storage.NewMemory())
+	for _, text := range []string{"rate limited", "network"} {
+		ref, err := wait(t, send(t, q, "C1", text))
+		if err != nil || ref.Timestamp == "" {
+			t.Errorf("%s: got %+v, %v, want a delivered message", text, ref, err)
+		}
+	}
+	if got := len(client.Posts()); got != 2 {
+		t.Errorf("got %d posts, want 2", got)
+	}
+}
+
+func TestPermanentFailure(t *testing.T) {
+	client := newFlakyClient(func(msg *chat.OutgoingMessage, attempt int) error {
+		if msg.Channel == "CGONE" {
+			return slack.SlackErrorResponse{Err: "channel_not_found"}
+		}
+		return errors.New("timeout")
+	})
+	store := storage.NewMemory()
+	q := newQueue(t, client, store)
+	if _, err := wait(t, send(t, q, "CGONE", "lost")); err == nil {
+		t.Errorf("expected an error")
+	}
+	if _, err := wait(t, send(t, q, "C1", "down")); err == nil {
+		t.Errorf("expected an error")
+	}
+	if client.attempts["lost"] != 1 {
+		t.Errorf("API error: got %d attempts, want 1", client.attempts["lost"])
+	}
+	if client.attempts["down"] != 3 {
+		t.Errorf("temporary error: got %d attempts, want 3", client.attempts["down"])
+	}
+	failed, err := q.Failed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 || failed[0].Text != "lost" || failed[1].Text != "down" || failed[1].Attempts != 3 {
+		t.Errorf("got failed messages %+v", failed)
+	}
+}
+
+func TestChannelOrder(t *testing.T) {
+	release := make(chan struct{})
+	client := newFlakyClient(func(msg *chat.OutgoingMessage, attempt int) error {
+		if msg.Text == "first" && attempt == 1 {
+			// blocks the channel C1 until released, then fails once.
+			<-release
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	q := newQueue(t, client, storage.NewMemory())
+	var c1 []*Delivery
+	for _, text := range []string{"first", "second", "third"} {
+		c1 = append(c1, send(t, q, "C1", text))
+	}
+	// other channels are not blocked.
+	if _, err := wait(t, send(t, q, "C2", "other")); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	for _, d := range c1 {
+		if _, err := wait(t, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, p := range client.Posts() {
+		got = append(got, p.Text)
+	}
+	want := []string{"other", "first", "second", "third"}
+	if len(got) != len(want) {
+		t.Fatalf("got posts %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got posts %q, want %q", got, want)
+		}
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	client := newFlakyClient(func(msg *chat.OutgoingMessage, attempt int) error {
+		<-release
+		return nil
+	})
+	cfg := Config{MaxPending: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	q := New(client, storage.NewMemory(), logrus.NewEntry(logrus.New()), metrics.NewRegistry(), cfg)
+	send(t, q, "C1", "one")
+	send(t, q, "C2", "two")
+	if _, err := q.Send(Message{Channel: "C1", Text: "three"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("got %v, want ErrQueueFull", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	client := newFlakyClient(func(msg *chat.OutgoingMessage, attempt int) error {
+		return errors.New("connection reset")
+	})
+	cfg := Config{MaxAttempts: 100, InitialBackoff: time.Hour}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	q := New(client, storage.NewMemory(), logrus.NewEntry(logrus.New()), metrics.NewRegistry(), cfg)
+	d := send(t, q, "C1", "pending")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop: got %v, want a deadline error", err)
+	}
+	if _, err := wait(t, d); !errors.Is(err, ErrStopped) {
+		t.Errorf("got %v, want ErrStopped", err)
+	}
+	if _, err := q.Send(Message{Channel: "C1", Text: "late"}); !errors.Is(err, ErrStopped) {
+		t.Errorf("Send after Stop: got %v, want ErrStopped", err)
+	}
+}
+
+func TestRetryPeriod(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want time.Duration
+	}{
+		// the defaults: 1s + 2s + 4s + 8s.
+		{Config{}, 15 * time.Second},
+		{Config{MaxAttempts: 8, InitialBackoff: 10 * time.Second}, 10*time.Second + 20*time.Second + 40*time.Second + 4*time.Minute},
+		{Config{MaxAttempts: 1}, 0},
+	} {
+		if err := tc.cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := tc.cfg.RetryPeriod(); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.cfg, got, tc.want)
+		}
+	}
+}
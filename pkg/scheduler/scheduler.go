@@ -0,0 +1,137 @@
+// Package scheduler runs functions at recurring times, e.g. daily reminders.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NextFunc returns the next time a job should run after t.
+type NextFunc func(t time.Time) time.Time
+
+// Daily returns a NextFunc that runs a job every day at the given time in the
+// given location.
+func Daily(hour, minute int, loc *time.Location) NextFunc {
+	return func(t time.Time) time.Time {
+		t = t.In(loc)
+		next := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, loc)
+		if !next.After(t) {
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, hour, minute, 0, 0, loc)
+		}
+		return next
+	}
+}
+
+// Every returns a NextFunc that runs a job at a fixed interval.
+func Every(d time.Duration) NextFunc {
+	return func(t time.Time) time.Time {
+		return t.Add(d)
+	}
+}
+
+// Job is a scheduled job.
+type Job struct {
+	Name string
+
+	mu     sync.Mutex
+	next   time.Time
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Next returns the next time the job will run. It is the zero time if the job
+// was cancelled.
+func (j *Job) Next() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.next
+}
+
+// Cancel stops the job. A running invocation is cancelled through its
+// context.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Done returns a channel that is closed when the job has stopped.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Scheduler runs jobs. The zero value is not usable, use New.
+type Scheduler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs []*Job
+}
+
+// New returns a new Scheduler.
+func New() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{ctx: ctx, cancel: cancel}
+}
+
+// Schedule runs fn at the times returned by next, until the job or the
+// scheduler are stopped. Invocations of the same job never overlap.
+func (s *Scheduler) Schedule(name string, next NextFunc, fn func(ctx context.Context)) *Job {
+	ctx, cancel := context.WithCancel(s.ctx)
+	j := Job{
+		Name:   name,
+		next:   next(time.Now()),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.jobs = append(s.jobs, &j)
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(j.done)
+		for {
+			timer := time.NewTimer(time.Until(j.Next()))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				j.mu.Lock()
+				j.next = time.Time{}
+				j.mu.Unlock()
+				return
+			case <-timer.C:
+			}
+			fn(ctx)
+			j.mu.Lock()
+			j.next = next(time.Now())
+			j.mu.Unlock()
+		}
+	}()
+	return &j
+}
+
+// Jobs returns the scheduled jobs.
+func (s *Scheduler) Jobs() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Job(nil), s.jobs...)
+}
+
+// Stop cancels all the jobs and waits for them to return, or for ctx to be
+// done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDaily(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	next := Daily(18, 30, loc)
+	for _, tc := range []struct {
+		now, want time.Time
+	}{
+		{time.Date(2024, 3, 1, 10, 0, 0, 0, loc), time.Date(2024, 3, 1, 18, 30, 0, 0, loc)},
+		{time.Date(2024, 3, 1, 18, 30, 0, 0, loc), time.Date(2024, 3, 2, 18, 30, 0, 0, loc)},
+		// 17:00 UTC is 19:00 in loc.
+		{time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC), time.Date(2024, 3, 2, 18, 30, 0, 0, loc)},
+		{time.Date(2024, 2, 29, 23, 0, 0, 0, loc), time.Date(2024, 3, 1, 18, 30, 0, 0, loc)},
+	} {
+		if got := next(tc.now); !got.Equal(tc.want) {
+			t.Errorf("next(%s) = %s, want %s", tc.now, got, tc.want)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s := New()
+	var runs, running, overlaps int32
+	j := s.Schedule("tick", Every(5*time.Millisecond), func(ctx context.Context) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&runs, 1)
+	})
+	if j.Next().IsZero() {
+		t.Errorf("the next run of a scheduled job is not set")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&runs) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	j.Cancel()
+	select {
+	case <-j.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cancelled job did not stop")
+	}
+	if n := atomic.LoadInt32(&runs); n < 3 {
+		t.Errorf("the job ran %d times, want at least 3", n)
+	}
+	if n := atomic.LoadInt32(&overlaps); n != 0 {
+		t.Errorf("the job overlapped %d times", n)
+	}
+	if !j.Next().IsZero() {
+		t.Errorf("got next run %s for a cancelled job", j.Next())
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	s := New()
+	started := make(chan struct{}, 1)
+	var cancelled atomic.Bool
+	s.Schedule("wait", Every(time.Millisecond), func(ctx context.Context) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		cancelled.Store(true)
+	})
+	idle := s.Schedule("idle", Every(time.Hour), func(ctx context.Context) {
+		t.Error("the idle job ran")
+	})
+	<-started
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled.Load() {
+		t.Errorf("the running invocation was not cancelled")
+	}
+	select {
+	case <-idle.Done():
+	default:
+		t.Errorf("the idle job did not stop")
+	}
+	if len(s.Jobs()) != 2 {
+		t.Errorf("got %d jobs, want 2", len(s.Jobs()))
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	s := New()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	s.Schedule("stuck", Every(time.Millisecond), func(ctx context.Context) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		// ignores the context.
+		<-release
+	})
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want a deadline error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	// this will register the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite is a Store backed by an SQLite database file.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates an SQLite store at the given path.
+func OpenSQLite(path string) (*SQLite, error) {
+	// the bot and the plugins write concurrently: wait for the lock instead
+	// of failing with "database is locked", and let readers proceed while
+	// writing.
+	dsn := path + "?_busy_timeout=5000&_journal_mode=WAL"
+	if strings.Contains(path, "?") {
+		dsn = path + "&_busy_timeout=5000&_journal_mode=WAL"
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %q: %w", path, err)
+	}
+	// a single connection serializes the writes of this process.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS kv (key TEXT PRIMARY KEY, value BLOB NOT NULL)`); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create table in %q: %w", path, err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// Get implements Store.Get.
+func (s *SQLite) Get(ctx context.Context, key string) ([]byte, error) {
+	var v []byte
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key = ?`, key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+// Put implements Store.Put.
+func (s *SQLite) Put(ctx context.Context, key string, value []byte) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO kv (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+// Delete implements Store.Delete.
+func (s *SQLite) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM kv WHERE key = ?`, key)
+	return err
+}
+
+// List implements Store.List.
+func (s *SQLite) List(ctx context.Context, prefix string) ([]string, error) {
+	// LIKE is case insensitive, compare the prefix instead
+	rows, err := s.db.QueryContext(ctx, `SELECT key FROM kv WHERE substr(key, 1, length(?1)) = ?1 ORDER BY key`, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,112 @@
+// Package storage provides the key-value stores that the bot and its plugins
+// use to persist state.
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by Get when a key does not exist.
+var ErrNotFound = errors.New("key not found")
+
+// Store is a key-value store. Implementations are safe for concurrent use.
+type Store interface {
+	// Get returns the value of a key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put sets the value of a key.
+	Put(ctx context.Context, key string, value []byte) error
+	// Delete removes a key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the sorted keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Memory is an in-memory Store, whose content is lost on restart.
+type Memory struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// NewMemory returns a new, empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{data: make(map[string][]byte)}
+}
+
+// Get implements Store.Get.
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Put implements Store.Put.
+func (m *Memory) Put(ctx context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete implements Store.Delete.
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+// List implements Store.List.
+func (m *Memory) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for k := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// WithPrefix returns a Store that prepends prefix to all the keys, so that
+// different users of the same underlying store do not collide.
+func WithPrefix(s Store, prefix string) Store {
+	return &prefixed{store: s, prefix: prefix}
+}
+
+type prefixed struct {
+	store  Store
+	prefix string
+}
+
+func (p *prefixed) Get(ctx context.Context, key string) ([]byte, error) {
+	return p.store.Get(ctx, p.prefix+key)
+}
+
+func (p *prefixed) Put(ctx context.Context, key string, value []byte) error {
+	return p.store.Put(ctx, p.prefix+key, value)
+}
+
+func (p *prefixed) Delete(ctx context.Context, key string) error {
+	return p.store.Delete(ctx, p.prefix+key)
+}
+
+func (p *prefixed) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := p.store.List(ctx, p.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		keys[i] = strings.TrimPrefix(k, p.prefix)
+	}
+	return keys, nil
+}
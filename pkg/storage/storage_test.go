@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// stores returns the stores to test, by name.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return map[string]Store{"memory": NewMemory(), "sqlite": db}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(missing): got %v, want ErrNotFound", err)
+			}
+			for _, kv := range [][2]string{{"a/1", "one"}, {"a/2", "two"}, {"A/3", "three"}, {"b", "bee"}, {"a/1", "uno"}} {
+				if err := s.Put(ctx, kv[0], []byte(kv[1])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if v, err := s.Get(ctx, "a/1"); err != nil || string(v) != "uno" {
+				t.Errorf("Get(a/1) = %q, %v, want the overwritten value", v, err)
+			}
+			// the prefix is case sensitive.
+			if keys, err := s.List(ctx, "a/"); err != nil || !reflect.DeepEqual(keys, []string{"a/1", "a/2"}) {
+				t.Errorf("List(a/) = %q, %v", keys, err)
+			}
+			if keys, err := s.List(ctx, ""); err != nil || len(keys) != 4 {
+				t.Errorf("List() = %q, %v, want all the 4 keys", keys, err)
+			}
+			if err := s.Delete(ctx, "a/1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(ctx, "a/1"); err != nil {
+				t.Errorf("deleting a missing key: %v", err)
+			}
+			if _, err := s.Get(ctx, "a/1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+	p := WithPrefix(s, "plugins/pinger/")
+	if err := p.Put(ctx, "k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "other", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(ctx, "plugins/pinger/k"); err != nil || string(v) != "v" {
+		t.Errorf("got %q, %v in the underlying store", v, err)
+	}
+	if keys, err := p.List(ctx, ""); err != nil || !reflect.DeepEqual(keys, []string{"k"}) {
+		t.Errorf("List() = %q, %v, want the unprefixed keys", keys, err)
+	}
+}
+
+func TestSQLiteConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bot.db")
+	// two stores on the same file, like two processes.
+	var dbs []*SQLite
+	for i := 0; i < 2; i++ {
+		db, err := OpenSQLite(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+	var mode string
+	if err := dbs[0].db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("got journal mode %q, %v, want wal", mode, err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 400)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db := dbs[i%len(dbs)]
+			for j := 0; j < 10; j++ {
+				if err := db.Put(ctx, fmt.Sprintf("k%d/%d", i, j), []byte("v")); err != nil {
+					errs <- err
+				}
+				if _, err := db.List(ctx, "k"); err != nil {
+					errs <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write failed: %v", err)
+	}
+	if keys, err := dbs[0].List(ctx, "k"); err != nil || len(keys) != 200 {
+		t.Errorf("got %d keys, %v, want 200", len(keys), err)
+	}
+}
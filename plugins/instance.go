@@ -0,0 +1,129 @@
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InstanceSeparator separates the plugin type from the instance name in the
+// configuration keys, e.g. "pinger/sre".
+const InstanceSeparator = "/"
+
+// ParseInstanceName splits a configuration key like "pinger/sre" into the
+// plugin type, "pinger", and the instance name, "sre". Keys without a
+// separator have an empty instance name.
+func ParseInstanceName(key string) (string, string) {
+	typ, inst, _ := strings.Cut(key, InstanceSeparator)
+	return typ, inst
+}
+
+// Instance is a configured instance of a plugin. Multiple instances of the
+// same plugin can be configured with different names and configurations, and
+// each instance can be bound to its own command names.
+type Instance struct {
+	// Plugin is the underlying plugin.
+	Plugin Plugin
+	// Type is the name of the registered plugin, e.g. "pinger".
+	Type string
+	// Services are the bot services passed to the plugin. They are nil
+	// until the instance is started by the bot.
+	Services *Services
+
+	name string
+	// commands maps the command names bound to this instance to the
+	// commands of the underlying plugin. If nil, the instance handles the
+	// plugin's own commands.
+	commands map[string]string
+}
+
+// NewInstance returns a new instance of a plugin with the given configuration
+// key, e.g. "pinger/sre", bound to the given commands. Each command is either
+// a name, which is mapped to the plugin's first documented command, or in the
+// form "name=command" to map it to a specific command of the plugin. If
+// commands is empty, the instance handles the plugin's own commands.
+func NewInstance(key string, plugin Plugin, commands []string) (*Instance, error) {
+	typ, name := ParseInstanceName(key)
+	if strings.Contains(key, InstanceSeparator) && name == "" {
+		return nil, fmt.Errorf("empty instance name in %q", key)
+	}
+	inst := Instance{
+		Plugin: plugin,
+		Type:   typ,
+		name:   key,
+	}
+	if len(commands) == 0 {
+		return &inst, nil
+	}
+	inst.commands = make(map[string]string, len(commands))
+	docs := Commands(plugin)
+	for _, c := range commands {
+		name, target, found := strings.Cut(c, "=")
+		if !found {
+			if len(docs) == 0 {
+				return nil, fmt.Errorf("plugin %s does not document its commands, use the form `name=command` for command %q", typ, c)
+			}
+			target = docs[0].Name
+		}
+		if name == "" || target == "" {
+			return nil, fmt.Errorf("invalid command %q", c)
+		}
+		if _, ok := inst.commands[name]; ok {
+			return nil, fmt.Errorf("duplicate command %q", name)
+		}
+		if !plugin.Handles(target) {
+			return nil, fmt.Errorf("plugin %s does not handle command %q", typ, target)
+		}
+		inst.commands[name] = target
+	}
+	return &inst, nil
+}
+
+// Name returns the instance name, i.e. its configuration key.
+func (i *Instance) Name() string {
+	return i.name
+}
+
+// Handles returns true if the instance is bound to the command.
+func (i *Instance) Handles(cmd string) bool {
+	if i.commands == nil {
+		return i.Plugin.Handles(cmd)
+	}
+	_, ok := i.commands[cmd]
+	return ok
+}
+
+// Command returns the command of the underlying plugin that cmd is mapped to.
+func (i *Instance) Command(cmd string) string {
+	if i.commands == nil {
+		return cmd
+	}
+	return i.commands[cmd]
+}
+
+// Commands returns the documented commands of the instance, with the names
+// they are bound to.
+func (i *Instance) Commands() []CommandInfo {
+	docs := Commands(i.Plugin)
+	if i.commands == nil {
+		return docs
+	}
+	names := make([]string, 0, len(i.commands))
+	for name := range i.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ret []CommandInfo
+	for _, name := range names {
+		target := i.commands[name]
+		for _, ci := range docs {
+			if ci.Matches(target) {
+				ci.Name = name
+				ci.Aliases = nil
+				ret = append(ret, ci)
+				break
+			}
+		}
+	}
+	return ret
+}
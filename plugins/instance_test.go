@@ -0,0 +1,92 @@
+package plugins
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+)
+
+// docPlugin handles and documents the commands "get" and "set".
+type docPlugin struct{}
+
+func (p docPlugin) Name() string            { return "doc" }
+func (p docPlugin) Load([]byte) error       { return nil }
+func (p docPlugin) Handles(cmd string) bool { return cmd == "get" || cmd == "set" || cmd == "g" }
+func (p docPlugin) HandleCmd(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+	return nil
+}
+
+func (p docPlugin) Commands() []CommandInfo {
+	return []CommandInfo{
+		{Name: "get", Aliases: []string{"g"}, Syntax: "<key>"},
+		{Name: "set", Syntax: "<key> <value>"},
+	}
+}
+
+func TestInstanceCommands(t *testing.T) {
+	inst, err := NewInstance("doc/sre", docPlugin{}, []string{"sre-get", "sre-set=set"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Name() != "doc/sre" || inst.Type != "doc" {
+		t.Errorf("got name %q and type %q, want doc/sre and doc", inst.Name(), inst.Type)
+	}
+	for cmd, want := range map[string]string{"sre-get": "get", "sre-set": "set", "get": "", "g": ""} {
+		if got := inst.Command(cmd); got != want {
+			t.Errorf("Command(%q) = %q, want %q", cmd, got, want)
+		}
+		if got := inst.Handles(cmd); got != (want != "") {
+			t.Errorf("Handles(%q) = %v", cmd, got)
+		}
+	}
+	want := []CommandInfo{
+		{Name: "sre-get", Syntax: "<key>"},
+		{Name: "sre-set", Syntax: "<key> <value>"},
+	}
+	if got := inst.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands() = %+v, want %+v", got, want)
+	}
+
+	// without commands, the instance handles the plugin's own commands.
+	inst, err = NewInstance("doc", docPlugin{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inst.Handles("g") || inst.Command("g") != "g" || len(inst.Commands()) != 2 {
+		t.Errorf("the default instance does not handle the plugin's commands")
+	}
+}
+
+func TestInstanceErrors(t *testing.T) {
+	for _, tc := range []struct {
+		key      string
+		plugin   Plugin
+		commands []string
+	}{
+		{"doc/", docPlugin{}, nil},
+		{"doc", docPlugin{}, []string{"a", "a=set"}},
+		{"doc", docPlugin{}, []string{"a=unknown"}},
+		{"doc", docPlugin{}, []string{"=get"}},
+		// undocumented plugins must name the target command.
+		{"undoc", undocPlugin{}, []string{"a"}},
+	} {
+		if _, err := NewInstance(tc.key, tc.plugin, tc.commands); err == nil {
+			t.Errorf("NewInstance(%q, %q): expected an error", tc.key, tc.commands)
+		}
+	}
+	if _, err := NewInstance("undoc", undocPlugin{}, []string{"a=run"}); err != nil {
+		t.Errorf("undocumented plugin bound with name=command: %v", err)
+	}
+}
+
+// undocPlugin handles the command "run" without documenting it.
+type undocPlugin struct{}
+
+func (p undocPlugin) Name() string            { return "undoc" }
+func (p undocPlugin) Load([]byte) error       { return nil }
+func (p undocPlugin) Handles(cmd string) bool { return cmd == "run" }
+func (p undocPlugin) HandleCmd(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+	return nil
+}
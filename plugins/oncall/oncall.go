@@ -5,11 +5,10 @@ package oncall
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"log"
 	"path"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -20,19 +19,19 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
-	"github.com/slack-go/slack"
-	"github.com/slack-go/slack/slackevents"
-	"github.com/slack-go/slack/socketmode"
 	"gopkg.in/yaml.v2"
 
 	"github.com/insomniacslk/slackbot/pkg/actions"
-	"github.com/insomniacslk/slackbot/pkg/credentials"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
+	"github.com/insomniacslk/slackbot/pkg/metrics"
+	"github.com/insomniacslk/slackbot/pkg/scheduler"
 	"github.com/insomniacslk/slackbot/plugins"
 )
 
 func init() {
-	if err := plugins.Register("oncall", &Oncall{}); err != nil {
-		log.Printf("Failed to register plugin 'oncall': %v", err)
+	if err := plugins.Register("oncall", func() plugins.Plugin { return &Oncall{} }); err != nil {
+		logrus.Errorf("Failed to register plugin 'oncall': %v", err)
 	}
 }
 
@@ -51,23 +50,45 @@ type oncallConfig struct {
 }
 
 // ErrUsage means that the specified command usage is invalid.
-var ErrUsage = errors.New("invalid usage")
+var ErrUsage = plugins.ErrUsage
 
 // Oncall is a PagerDuty oncall plugin.
 type Oncall struct {
 	Config *oncallConfig
+
+	svc       *plugins.Services
+	reminders []reminder
+	mu        sync.Mutex
+	jobs      []*scheduler.Job
+	sent      *metrics.Counter
 }
 
 // Name returns the plugin name
-func (g Oncall) Name() string {
+func (g *Oncall) Name() string {
 	return "oncall"
 }
 
 // Handles returns true if it can handle that command.
-func (g Oncall) Handles(cmd string) bool {
+func (g *Oncall) Handles(cmd string) bool {
 	return cmd == "oncall"
 }
 
+// RequiredScopes returns the Slack OAuth scopes needed by the plugin.
+func (g *Oncall) RequiredScopes() []string {
+	return []string{"users:read", "users:read.email"}
+}
+
+// Commands returns the description of the commands handled by the plugin.
+func (g *Oncall) Commands() []plugins.CommandInfo {
+	return []plugins.CommandInfo{
+		{
+			Name:        "oncall",
+			Syntax:      "[schedule name]",
+			Description: "show who is oncall for the default schedule, or for the schedules matching the given name",
+		},
+	}
+}
+
 type reminder struct {
 	location *time.Location
 	hour     int
@@ -122,64 +143,98 @@ func (g *Oncall) Load(configYAML []byte) error {
 		if len(reminders) == 0 {
 			return fmt.Errorf("reminders enabled but no reminder is set")
 		}
-		log.Printf("Oncall reminders enabled\n")
-		go g.runReminders(reminders, conf.HandoffReminders.ChannelID)
+		logrus.Infof("Oncall reminders enabled")
 	} else {
-		log.Printf("Oncall reminders not enabled")
+		logrus.Infof("Oncall reminders not enabled")
 	}
 	g.Config = &conf
+	g.reminders = reminders
 	return nil
 }
 
-func updateTimer(reminders []reminder) (*reminder, *time.Time, *time.Timer) {
-	now := time.Now()
-	var (
-		earliest *time.Time
-		reminder *reminder
-	)
-	for _, r := range reminders {
-		rtime := time.Date(now.Year(), now.Month(), now.Day(), r.hour, r.minute, 0, 0, r.location)
-		if rtime.Before(now) {
-			// next one is one day after
-			rtime = rtime.Add(24 * time.Hour)
+// Init stores the bot services and registers the plugin metrics.
+func (g *Oncall) Init(svc *plugins.Services) error {
+	g.svc = svc
+	g.sent = svc.Metrics.Counter("slackbot_oncall_reminders_total", "Handoff reminders sent, by plugin instance and outcome.", "instance", "outcome")
+	return nil
+}
+
+// Start schedules the handoff reminders, if enabled. They are stopped by the
+// bot together with the scheduler.
+func (g *Oncall) Start(ctx context.Context) error {
+	if len(g.reminders) == 0 {
+		return nil
+	}
+	dest := g.Config.HandoffReminders.ChannelID
+	g.svc.Log.Infof("Running %d oncall reminders", len(g.reminders))
+	for _, r := range g.reminders {
+		r := r
+		job := g.svc.Scheduler.Schedule("reminder "+r.String(), scheduler.Daily(r.hour, r.minute, r.location), func(ctx context.Context) {
+			g.sendReminder(ctx, &r, dest)
+		})
+		g.svc.Log.Infof("- %s, next tick: %s", r.String(), job.Next())
+		g.mu.Lock()
+		g.jobs = append(g.jobs, job)
+		g.mu.Unlock()
+	}
+	return nil
+}
+
+// reminderGracePeriod is how long a reminder can be late, besides the retries
+// of its delivery, before the plugin is reported as unhealthy.
+const reminderGracePeriod = time.Minute
+
+// gracePeriod returns how long a reminder can be late while it is being
+// sent, including the retries of the outbound queue.
+func (g *Oncall) gracePeriod() time.Duration {
+	if g.svc.Outbound == nil {
+		return reminderGracePeriod
+	}
+	return reminderGracePeriod + g.svc.Outbound.Config().RetryPeriod()
+}
+
+// HealthCheck returns an error if a handoff reminder job stopped or is
+// overdue.
+func (g *Oncall) HealthCheck(ctx context.Context) error {
+	grace := g.gracePeriod()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, job := range g.jobs {
+		select {
+		case <-job.Done():
+			return fmt.Errorf("%s stopped", job.Name)
+		default:
 		}
-		if earliest == nil {
-			earliest = &rtime
-			reminder = &r
-		} else {
-			if rtime.Before(*earliest) {
-				earliest = &rtime
-				reminder = &r
-			}
+		if next := job.Next(); time.Since(next) > grace {
+			return fmt.Errorf("%s is overdue, next tick was %s", job.Name, next)
 		}
 	}
-	return reminder, earliest, time.NewTimer(time.Until(*earliest))
+	return nil
 }
 
-func (g *Oncall) runReminders(reminders []reminder, dest string) {
-	log.Printf("Running %d oncall reminders", len(reminders))
-	for _, r := range reminders {
-		log.Printf("- %s", r.String())
+func (g *Oncall) sendReminder(ctx context.Context, r *reminder, dest string) {
+	var out bytes.Buffer
+	if err := r.template.Execute(&out, nil); err != nil {
+		g.svc.Log.Errorf("Failed to execute oncall reminder template: %v", err)
+		g.sent.Inc(g.svc.Name, "error")
+		return
 	}
-	api := slack.New(credentials.SlackBotToken, slack.OptionAppLevelToken(credentials.SlackAppLevelToken))
-	client := socketmode.New(api)
-	reminder, when, timer := updateTimer(reminders)
-	for {
-		log.Printf("Next tick: %s", when)
-		<-timer.C
-		// print reminder
-		var out bytes.Buffer
-		if err := reminder.template.Execute(&out, nil); err != nil {
-			log.Printf("Error: failed to execute oncall reminder template: %v", err)
-		}
-		reminder, when, timer = updateTimer(reminders)
-		actions.Say(client, dest, "", out.String())
+	if err := actions.Say(ctx, g.svc.Chat, dest, "", out.String()); err != nil {
+		g.sent.Inc(g.svc.Name, "error")
+		return
 	}
+	g.sent.Inc(g.svc.Name, "ok")
+}
+
+// pagerduty returns a new PagerDuty client.
+func (g *Oncall) pagerduty() *pagerduty.Client {
+	client := pagerduty.NewClient(g.svc.Credentials.PagerDutyAPIKey.Value())
+	client.HTTPClient = g.svc.HTTPClient
+	return client
 }
 
-func (g *Oncall) get(scheduleID string) ([]pagerduty.OnCall, error) {
-	client := pagerduty.NewClient(credentials.PagerDutyAPIKey)
-	ctx := context.Background()
+func (g *Oncall) get(ctx context.Context, scheduleID string) ([]pagerduty.OnCall, error) {
+	client := g.pagerduty()
 	opts := pagerduty.ListOnCallOptions{
 		ScheduleIDs: []string{scheduleID},
 		Includes:    []string{"users"},
@@ -197,7 +252,13 @@ func timeInLocation(t time.Time, loc *time.Location) string {
 }
 
 // HandleCmd is called when a .wea/.weather command is invoked.
-func (g *Oncall) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEvent, arg string) error {
+func (g *Oncall) HandleCmd(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+	if g.Config == nil {
+		return fmt.Errorf("plugin is not configured")
+	}
+	if g.svc == nil {
+		return fmt.Errorf("plugin is not initialized")
+	}
 	var scheduleIDs []string
 	locations := make([]*time.Location, 0)
 	for _, locName := range g.Config.Locations {
@@ -210,14 +271,15 @@ func (g *Oncall) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEve
 	if len(locations) == 0 {
 		locations = []*time.Location{time.UTC}
 	}
-	if arg == "" {
+	// the whole text is the query, including words starting with `--`.
+	query := cmd.Arg
+	if query == "" {
 		scheduleIDs = []string{g.Config.DefaultScheduleID}
 	} else {
 		// search schedules by name
-		pdclient := pagerduty.NewClient(credentials.PagerDutyAPIKey)
-		ctx := context.Background()
+		pdclient := g.pagerduty()
 		opts := pagerduty.ListSchedulesOptions{
-			Query: arg,
+			Query: query,
 		}
 		resp, err := pdclient.ListSchedulesWithContext(ctx, opts)
 		if err != nil {
@@ -230,9 +292,10 @@ func (g *Oncall) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEve
 	if scheduleIDs == nil {
 		return fmt.Errorf("invalid empty schedule ID")
 	}
-	log.Printf("Getting oncalls for schedule IDs %v", scheduleIDs)
+	log := logging.FromContext(ctx)
+	log.Debugf("Getting oncalls for schedule IDs %v", scheduleIDs)
 	for _, scheduleID := range scheduleIDs {
-		oncallList, err := g.get(scheduleID)
+		oncallList, err := g.get(ctx, scheduleID)
 		if err != nil {
 			return err
 		}
@@ -245,19 +308,18 @@ func (g *Oncall) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEve
 			}
 			prev = &oncall
 			oncallByRotation[oncall.Schedule.Summary] = append(oncallByRotation[oncall.Schedule.Summary], oncall)
-			logrus.Infof("Appending oncall %s (%s -> %s)", oncall.User.Summary, oncall.Start, oncall.End)
+			log.Debugf("Appending oncall %s (%s -> %s)", oncall.User.Summary, oncall.Start, oncall.End)
 		}
 		for sched, oncalls := range oncallByRotation {
-			var msg string
+			title := "*" + sched + "*"
 			if len(oncalls) > 0 {
 				// assume that the schedule URL is the same for all the other
 				// items, since they were grouped together by schedule name.
-				msg += fmt.Sprintf("*<%s|%s>*:\n", oncalls[0].Schedule.HTMLURL, sched)
-			} else {
-				msg += "*" + sched + "*"
+				title = fmt.Sprintf("*<%s|%s>*", oncalls[0].Schedule.HTMLURL, sched)
 			}
-			idx := 0
-			for _, oncall := range oncalls {
+			msg := actions.NewMessage("Oncall for %s", sched).Section(title)
+			var next []string
+			for idx, oncall := range oncalls {
 				timeFormat := "2006-01-02T15:04:05Z"
 				oncallEnd, err := time.Parse(timeFormat, oncall.End)
 				if err != nil {
@@ -267,27 +329,22 @@ func (g *Oncall) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEve
 				for _, loc := range locations {
 					timeList = append(timeList, timeInLocation(oncallEnd, loc))
 				}
-				switch idx {
-				case 0:
-					slackUser, err := client.GetUserByEmail(oncall.User.Email)
-					if err == nil {
-						msg += fmt.Sprintf("  Current oncall: <@%s> (until %s).\n", slackUser.ID, strings.Join(timeList, " | "))
+				if idx == 0 {
+					user := fmt.Sprintf("<%s|%s>", oncall.User.HTMLURL, oncall.User.Summary)
+					if slackUser, err := client.GetUserByEmail(ctx, oncall.User.Email); err == nil {
+						user = fmt.Sprintf("<@%s>", slackUser.ID)
 					} else {
-						log.Printf("Warning: no Slack user found for email %q", oncall.User.Email)
-						msg += fmt.Sprintf("  Current oncall: <%s|%s> (until %s).\n", oncall.User.HTMLURL, oncall.User.Summary, strings.Join(timeList, " | "))
+						log.Warnf("No Slack user found for email %q", oncall.User.Email)
 					}
-				case 1:
-					msg += fmt.Sprintf("  Next 24h:\n    * <%s|%s> (until %s)\n", oncall.User.HTMLURL, oncall.User.Summary, strings.Join(timeList, " | "))
-				default:
-					msg += fmt.Sprintf("    * <%s|%s> (until %s)\n", oncall.User.HTMLURL, oncall.User.Summary, strings.Join(timeList, " | "))
+					msg.Fields("*Current oncall*\n"+user, "*Until*\n"+strings.Join(timeList, "\n"))
+					continue
 				}
-				idx++
+				next = append(next, fmt.Sprintf("• <%s|%s> (until %s)", oncall.User.HTMLURL, oncall.User.Summary, strings.Join(timeList, " | ")))
 			}
-			threadTS := ""
-			if ev.ThreadTimeStamp != "" {
-				threadTS = ev.ThreadTimeStamp
+			if len(next) > 0 {
+				msg.Divider().Section("*Next 24h*\n" + strings.Join(next, "\n"))
 			}
-			actions.Say(client, ev.Channel, threadTS, msg)
+			msg.Post(ctx, client, cmd.Message.Channel, cmd.Message.ThreadTimestamp)
 		}
 	}
 	return nil
@@ -4,27 +4,25 @@ package pinger
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	// this will register the sqlite3 driver
 
 	"github.com/PagerDuty/go-pagerduty"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/slack-go/slack/slackevents"
-	"github.com/slack-go/slack/socketmode"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
 	"github.com/insomniacslk/slackbot/pkg/actions"
-	"github.com/insomniacslk/slackbot/pkg/credentials"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/logging"
 	"github.com/insomniacslk/slackbot/plugins"
 )
 
 func init() {
-	if err := plugins.Register("pinger", &Pinger{}); err != nil {
-		log.Printf("Failed to register plugin 'pinger': %v", err)
+	if err := plugins.Register("pinger", func() plugins.Plugin { return &Pinger{} }); err != nil {
+		logrus.Errorf("Failed to register plugin 'pinger': %v", err)
 	}
 }
 
@@ -34,11 +32,13 @@ type pingerConfig struct {
 }
 
 // ErrUsage means that the specified command usage is invalid.
-var ErrUsage = errors.New("invalid usage")
+var ErrUsage = plugins.ErrUsage
 
 // Pinger is a plugin that pings the oncall or an entire team, trying to match the pagerduty oncall to a Slack user.
 type Pinger struct {
 	Config *pingerConfig
+
+	svc *plugins.Services
 }
 
 // Name returns the plugin name
@@ -51,6 +51,21 @@ func (g Pinger) Handles(cmd string) bool {
 	return cmd == "ping"
 }
 
+// RequiredScopes returns the Slack OAuth scopes needed by the plugin.
+func (g Pinger) RequiredScopes() []string {
+	return []string{"users:read", "users:read.email"}
+}
+
+// Commands returns the description of the commands handled by the plugin.
+func (g Pinger) Commands() []plugins.CommandInfo {
+	return []plugins.CommandInfo{
+		{
+			Name:        "ping",
+			Description: "ping the current oncall of the configured schedule",
+		},
+	}
+}
+
 // Load loads the passed configuration.
 func (g *Pinger) Load(configYAML []byte) error {
 	var conf pingerConfig
@@ -61,9 +76,15 @@ func (g *Pinger) Load(configYAML []byte) error {
 	return nil
 }
 
-func (g *Pinger) getOncalls(scheduleID string) ([]pagerduty.OnCall, error) {
-	client := pagerduty.NewClient(credentials.PagerDutyAPIKey)
-	ctx := context.Background()
+// Init stores the bot services.
+func (g *Pinger) Init(svc *plugins.Services) error {
+	g.svc = svc
+	return nil
+}
+
+func (g *Pinger) getOncalls(ctx context.Context, scheduleID string) ([]pagerduty.OnCall, error) {
+	client := pagerduty.NewClient(g.svc.Credentials.PagerDutyAPIKey.Value())
+	client.HTTPClient = g.svc.HTTPClient
 	opts := pagerduty.ListOnCallOptions{
 		ScheduleIDs: []string{scheduleID},
 		Includes:    []string{"users"},
@@ -77,14 +98,21 @@ func (g *Pinger) getOncalls(scheduleID string) ([]pagerduty.OnCall, error) {
 }
 
 // HandleCmd is called when a .wea/.weather command is invoked.
-func (g *Pinger) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEvent, arg string) error {
-	// ignore `arg`, we only use the configuration file.
+func (g *Pinger) HandleCmd(ctx context.Context, client chat.Client, cmd *chat.Command) error {
+	if g.Config == nil {
+		return fmt.Errorf("plugin is not configured")
+	}
+	if g.svc == nil {
+		return fmt.Errorf("plugin is not initialized")
+	}
+	// ignore `cmd.Arg`, we only use the configuration file.
 	scheduleID := g.Config.ScheduleID
 	if scheduleID == "" {
 		return fmt.Errorf("`schedule_id` is empty or not set")
 	}
-	oncalls, err := g.getOncalls(scheduleID)
-	log.Printf("Getting oncalls for schedule IDs %v", scheduleID)
+	log := logging.FromContext(ctx)
+	log.Debugf("Getting oncalls for schedule ID %s", scheduleID)
+	oncalls, err := g.getOncalls(ctx, scheduleID)
 	if err != nil {
 		return fmt.Errorf("failed to get oncalls for schedule ID %s: %w", scheduleID, err)
 	}
@@ -106,9 +134,9 @@ func (g *Pinger) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEve
 		}
 		oncall := oncalls[0]
 		// search Slack user by email, using the oncall's email from PagerDuty
-		user, err := client.GetUserByEmail(oncall.User.Email)
+		user, err := client.GetUserByEmail(ctx, oncall.User.Email)
 		if err != nil {
-			log.Printf("Warning: no Slack user found for e-mail %q: %v", oncall.User.Email, err)
+			log.Warnf("No Slack user found for e-mail %q: %v", oncall.User.Email, err)
 			for _, uid := range g.Config.FallbackUsers {
 				msg += fmt.Sprintf("<@%s> ", uid)
 			}
@@ -116,10 +144,10 @@ func (g *Pinger) HandleCmd(client *socketmode.Client, ev *slackevents.MessageEve
 			msg += fmt.Sprintf("<@%s>", user.ID)
 		}
 		threadTS := ""
-		if ev.ThreadTimeStamp != "" {
-			threadTS = ev.ThreadTimeStamp
+		if cmd.Message.ThreadTimestamp != "" {
+			threadTS = cmd.Message.ThreadTimestamp
 		}
-		actions.Say(client, ev.Channel, threadTS, msg)
+		actions.Say(ctx, client, cmd.Message.Channel, threadTS, msg)
 	}
 	return nil
 }
@@ -0,0 +1,83 @@
+package pinger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/chat/chattest"
+	"github.com/insomniacslk/slackbot/plugins"
+)
+
+// handlerTransport serves the HTTP requests with a handler, in place of the
+// PagerDuty API.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.h.ServeHTTP(w, r)
+	return w.Result(), nil
+}
+
+// newPinger returns a pinger for a PagerDuty schedule whose oncall has the
+// given email.
+func newPinger(t *testing.T, email string) *Pinger {
+	t.Helper()
+	pd := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oncalls" || r.URL.Query().Get("schedule_ids[]") != "P123" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"oncalls": []map[string]interface{}{{
+				"user":     map[string]interface{}{"email": email},
+				"schedule": map[string]interface{}{"summary": "SRE", "html_url": "https://pd/P123"},
+			}},
+		})
+	})
+	var p Pinger
+	if err := p.Load([]byte("schedule_id: P123\nfallback_users: [UFALLBACK]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(&plugins.Services{HTTPClient: &http.Client{Transport: handlerTransport{pd}}}); err != nil {
+		t.Fatal(err)
+	}
+	return &p
+}
+
+func ping(t *testing.T, p *Pinger, client chat.Client) {
+	t.Helper()
+	cmd := chat.Command{Name: "ping", Message: chat.Message{Channel: "C1", Timestamp: "2.2", ThreadTimestamp: "1.1"}}
+	if err := p.HandleCmd(context.Background(), client, &cmd); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	client := chattest.NewClient()
+	client.AddUser(chat.User{ID: "UONCALL", Email: "oncall@example.com"})
+	ping(t, newPinger(t, "oncall@example.com"), client)
+	posts := client.Posts()
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+	want := "Ping oncall for *<https://pd/P123|SRE>*: <@UONCALL>"
+	if p := posts[0]; p.Text != want || p.Channel != "C1" || p.ThreadTS != "1.1" {
+		t.Errorf("got %q in %s thread %q, want %q in C1 thread 1.1", p.Text, p.Channel, p.ThreadTS, want)
+	}
+}
+
+func TestPingFallback(t *testing.T) {
+	client := chattest.NewClient()
+	ping(t, newPinger(t, "unknown@example.com"), client)
+	posts := client.Posts()
+	want := "Ping oncall for *<https://pd/P123|SRE>*: <@UFALLBACK> "
+	if len(posts) != 1 || posts[0].Text != want {
+		t.Errorf("got posts %+v, want %q", posts, want)
+	}
+}
@@ -1,24 +1,138 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"regexp"
+	"strings"
 	"sync"
 
-	"github.com/slack-go/slack/slackevents"
-	"github.com/slack-go/slack/socketmode"
+	"github.com/insomniacslk/slackbot/pkg/bot/cmdline"
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/sirupsen/logrus"
 )
 
+// ErrUsage means that a command was invoked with invalid arguments. When a
+// plugin returns an error wrapping ErrUsage, the bot replies with the usage of
+// the command.
+var ErrUsage = cmdline.ErrUsage
+
 // Plugin is the interface that every plugin must implement.
 type Plugin interface {
 	Name() string
-	HandleCmd(*socketmode.Client, *slackevents.MessageEvent, string) error
+	// HandleCmd handles a command. The context is cancelled when the
+	// command times out or the bot shuts down.
+	HandleCmd(context.Context, chat.Client, *chat.Command) error
 	Load([]byte) error
 	Handles(string) bool
 }
 
+// Stopper is an optional interface that plugins can implement to release
+// their resources, e.g. background goroutines, when the bot shuts down. Stop
+// should return when ctx is done even if the plugin did not stop cleanly.
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// ScopeRequirer is an optional interface that plugins can implement to
+// declare the Slack OAuth scopes they need, e.g. `users:read.email` to look up
+// users by e-mail. The bot's self-check reports the missing ones.
+type ScopeRequirer interface {
+	RequiredScopes() []string
+}
+
+// HealthChecker is an optional interface for plugins that can report
+// problems, e.g. a background job that stopped. HealthCheck returns a non-nil
+// error if the plugin is unhealthy, which makes the bot not ready on its
+// /readyz endpoint. It does not affect the liveness reported on /healthz.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// InteractionHandler is an optional interface for plugins that post
+// interactive blocks, e.g. buttons and menus, or open modal views. The action
+// IDs and view callback IDs must be namespaced with Services.ActionID, so
+// that the bot routes the interactions to the plugin instance. Views are
+// closed on submission unless HandleInteraction returns chat.ViewErrors
+// promptly.
+type InteractionHandler interface {
+	HandleInteraction(ctx context.Context, client chat.Client, in *chat.Interaction) error
+}
+
+// MessageListener is an optional interface for plugins that react to messages
+// that are not commands, e.g. to expand the ticket IDs mentioned in a
+// conversation. HandleMatch is called once for every message, in the channels
+// the bot is a member of, whose text matches at least one of the patterns.
+// The messages of the bot itself are never matched.
+type MessageListener interface {
+	Patterns() []*regexp.Regexp
+	HandleMatch(ctx context.Context, client chat.Client, m *chat.Match) error
+}
+
+// EventSubscriber is an optional interface for plugins that react to chat
+// events, e.g. chat.EventMemberJoinedChannel to welcome new members. Events
+// returns the event types the plugin subscribes to; the bot app must be
+// subscribed to them as well. Like commands, the messages and mentions sent
+// by the bot itself or by the ignored bots are not delivered.
+type EventSubscriber interface {
+	Events() []string
+	HandleEvent(ctx context.Context, client chat.Client, ev *chat.Event) error
+}
+
+// CommandInfo describes a command handled by a plugin.
+type CommandInfo struct {
+	Name    string
+	Aliases []string
+	// Syntax describes the arguments of the command, e.g. "[schedule name]".
+	Syntax      string
+	Description string
+}
+
+// Usage returns the usage string of the command, using the given command
+// prefix.
+func (c CommandInfo) Usage(prefix string) string {
+	if c.Syntax == "" {
+		return prefix + c.Name
+	}
+	return prefix + c.Name + " " + c.Syntax
+}
+
+// Matches returns true if cmd is the name or an alias of this command.
+func (c CommandInfo) Matches(cmd string) bool {
+	if cmd == c.Name {
+		return true
+	}
+	for _, a := range c.Aliases {
+		if cmd == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Documenter is an optional interface that plugins can implement to describe
+// the commands they handle. The descriptions are used by the built-in help
+// command and to report usage errors.
+type Documenter interface {
+	Commands() []CommandInfo
+}
+
+// Commands returns the commands documented by a plugin, or nil if the plugin
+// does not implement Documenter.
+func Commands(p Plugin) []CommandInfo {
+	if d, ok := p.(Documenter); ok {
+		return d.Commands()
+	}
+	return nil
+}
+
+// Factory creates a new, unconfigured instance of a plugin. The bot calls it
+// once for every configured instance of the plugin, and again when an
+// instance's configuration is reloaded.
+type Factory func() Plugin
+
 type _plugins struct {
-	registered map[string]Plugin
+	registered map[string]Factory
 	mutex      sync.Mutex
 }
 
@@ -26,34 +140,42 @@ var plugins *_plugins
 
 func init() {
 	plugins = &_plugins{
-		registered: make(map[string]Plugin),
+		registered: make(map[string]Factory),
 	}
 }
 
-func (p *_plugins) register(name string, plugin Plugin) error {
+func (p *_plugins) register(name string, factory Factory) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	if strings.Contains(name, InstanceSeparator) {
+		return fmt.Errorf("invalid plugin name %q: cannot contain %q", name, InstanceSeparator)
+	}
 	if _, present := p.registered[name]; present {
 		return fmt.Errorf("plugin %s already registered", name)
 	}
-	p.registered[name] = plugin
-	log.Printf("registered plugin %s", name)
+	p.registered[name] = factory
+	logrus.Debugf("Registered plugin %s", name)
 	return nil
 }
 
-func (p *_plugins) get(name string) Plugin {
+func (p *_plugins) get(name string) Factory {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 	return p.registered[name]
 }
 
-// Get returns a plugin object, if registered, or nil.
-func Get(name string) Plugin {
-	return plugins.get(name)
+// New returns a new, unconfigured instance of a registered plugin, or nil if
+// no plugin with that name is registered.
+func New(name string) Plugin {
+	factory := plugins.get(name)
+	if factory == nil {
+		return nil
+	}
+	return factory()
 }
 
-// Register adds a plugin by name to the map of registered plugins. If a plugin
-// with the same name is registered already, an error is returned.
-func Register(name string, plugin Plugin) error {
-	return plugins.register(name, plugin)
+// Register adds a plugin factory by name to the map of registered plugins. If
+// a plugin with the same name is registered already, an error is returned.
+func Register(name string, factory Factory) error {
+	return plugins.register(name, factory)
 }
@@ -0,0 +1,79 @@
+package plugins
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/insomniacslk/slackbot/pkg/chat"
+	"github.com/insomniacslk/slackbot/pkg/credentials"
+	"github.com/insomniacslk/slackbot/pkg/metrics"
+	"github.com/insomniacslk/slackbot/pkg/outbound"
+	"github.com/insomniacslk/slackbot/pkg/scheduler"
+	"github.com/insomniacslk/slackbot/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// Services are the bot services available to a plugin instance. Plugins
+// should use them instead of creating their own clients or relying on global
+// state, so that they can be tested and run multiple times in one process.
+type Services struct {
+	// Name is the name of the plugin instance, e.g. "pinger/sre".
+	Name string
+	// CmdPrefix is the bot's command prefix.
+	CmdPrefix string
+	// Chat is the chat client shared by the bot and all the plugins, for
+	// messages that are not a reply to a command.
+	Chat chat.Client
+	// Outbound is the queue delivering the messages posted through Chat.
+	// Plugins can use it to send messages without waiting for their
+	// delivery.
+	Outbound *outbound.Queue
+	// Log is a logger scoped to the plugin instance.
+	Log *logrus.Entry
+	// Storage is a key-value store scoped to the plugin instance.
+	Storage storage.Store
+	// Scheduler runs recurring jobs. It is stopped after the plugin.
+	Scheduler *scheduler.Scheduler
+	// HTTPClient is the client to use for outgoing HTTP requests. Its
+	// requests are measured in the bot's metrics.
+	HTTPClient *http.Client
+	// Metrics is the bot's metrics registry, where plugins can register their
+	// own metrics. The metric names should start with `slackbot_`, and include
+	// an instance label set to Name if the plugin can have multiple instances.
+	// Registering a metric that exists with another type or labels panics,
+	// which fails the start of the plugin.
+	Metrics *metrics.Registry
+	// Credentials are the credentials from the bot configuration.
+	Credentials credentials.Credentials
+	// Auth checks the permissions granted in the bot's access control
+	// configuration.
+	Auth Authorizer
+}
+
+// ActionID returns the namespaced form of a plugin action or view callback
+// ID, e.g. "pinger/sre:ack" for "ack", so that the interactions are routed
+// back to this plugin instance.
+func (s *Services) ActionID(id string) string {
+	return s.Name + chat.ActionSeparator + id
+}
+
+// Authorizer checks the permissions of the users invoking commands.
+type Authorizer interface {
+	// HasPermission returns true if the user who sent msg holds the named
+	// permission in msg's channel.
+	HasPermission(ctx context.Context, msg *chat.Message, permission string) (bool, error)
+}
+
+// Initializer is an optional interface for plugins that need the bot
+// services. Init is called once per instance, after Load and before Start.
+type Initializer interface {
+	Init(*Services) error
+}
+
+// Starter is an optional interface for plugins that run background work,
+// e.g. scheduled jobs. Start is called when the bot starts, or when the
+// instance is loaded by a configuration reload, and must not block. The
+// background work must be stopped by Stop, see Stopper.
+type Starter interface {
+	Start(ctx context.Context) error
+}